@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,19 +13,83 @@ type Env struct {
 	Addr      string `mapstructure:"SERVER_PORT"`
 	JWTSecret string `mapstructure:"JWT_SECRET"`
 
+	// StorageDriver is where images are stored: s3, fs or memory. The fs
+	// driver stores them under StorageRoot, the fs and memory drivers serve
+	// them from FilesBaseURL.
+	StorageDriver string `mapstructure:"STORAGE_DRIVER"`
+	StorageRoot   string `mapstructure:"STORAGE_ROOT"`
+	FilesBaseURL  string `mapstructure:"FILES_BASE_URL"`
+
 	AWSSecretKey string `mapstructure:"AWS_SECRET_KEY"`
 	AWSAccessKey string `mapstructure:"AWS_ACCESS_KEY"`
 	BucketName   string `mapstructure:"BUCKET_NAME"`
 	AWSRegion    string `mapstructure:"AWS_REGION"`
 
+	// AWSEndpointURL points the client to S3 compatible storages such as
+	// MinIO, which usually need AWSUsePathStyle. S3PublicBaseURL replaces
+	// the bucket url in image urls, e.g. for a CDN. S3PresignEndpointURL
+	// is the endpoint presigned urls are signed for, when clients reach the
+	// storage at another host than the API, AWSEndpointURL by default.
+	AWSEndpointURL       string `mapstructure:"AWS_ENDPOINT_URL"`
+	AWSUsePathStyle      bool   `mapstructure:"AWS_USE_PATH_STYLE"`
+	S3PublicBaseURL      string `mapstructure:"S3_PUBLIC_BASE_URL"`
+	S3PresignEndpointURL string `mapstructure:"S3_PRESIGN_ENDPOINT_URL"`
+
+	// PrivateBucket serves images through presigned urls valid for
+	// SignedURLExpiry, except the images uploaded as public. Only the s3
+	// driver supports it.
+	PrivateBucket   bool          `mapstructure:"PRIVATE_BUCKET"`
+	SignedURLExpiry time.Duration `mapstructure:"SIGNED_URL_EXPIRY"`
+
 	KafkaBroker     string `mapstructure:"KAFKA_BROKER"`
 	KafkaTasksTopic string `mapstructure:"KAFKA_TASKS_TOPIC"`
 
 	RedisURL string `mapstructure:"REDIS_URL"`
+
+	// MaxUploadSize is the largest file accepted by uploads, in bytes.
+	MaxUploadSize int64 `mapstructure:"MAX_UPLOAD_SIZE"`
+
+	// Image size limits of each user tier, zero is unlimited.
+	FreeMaxPixels      int `mapstructure:"FREE_MAX_PIXELS"`
+	FreeMaxWidth       int `mapstructure:"FREE_MAX_WIDTH"`
+	FreeMaxHeight      int `mapstructure:"FREE_MAX_HEIGHT"`
+	FreeMaxFrames      int `mapstructure:"FREE_MAX_FRAMES"`
+	FreeMaxTotalPixels int `mapstructure:"FREE_MAX_TOTAL_PIXELS"`
+	ProMaxPixels       int `mapstructure:"PRO_MAX_PIXELS"`
+	ProMaxWidth        int `mapstructure:"PRO_MAX_WIDTH"`
+	ProMaxHeight       int `mapstructure:"PRO_MAX_HEIGHT"`
+	ProMaxFrames       int `mapstructure:"PRO_MAX_FRAMES"`
+	ProMaxTotalPixels  int `mapstructure:"PRO_MAX_TOTAL_PIXELS"`
+}
+
+var defaults = map[string]any{
+	"STORAGE_DRIVER":          "s3",
+	"STORAGE_ROOT":            "data",
+	"FILES_BASE_URL":          "http://localhost:8080/files",
+	"AWS_ENDPOINT_URL":        "",
+	"AWS_USE_PATH_STYLE":      false,
+	"S3_PUBLIC_BASE_URL":      "",
+	"S3_PRESIGN_ENDPOINT_URL": "",
+	"PRIVATE_BUCKET":          false,
+	"SIGNED_URL_EXPIRY":       time.Hour,
+	"MAX_UPLOAD_SIZE":         100 << 20,
+	"FREE_MAX_PIXELS":         25_000_000,
+	"FREE_MAX_WIDTH":          8192,
+	"FREE_MAX_HEIGHT":         8192,
+	"FREE_MAX_FRAMES":         100,
+	"FREE_MAX_TOTAL_PIXELS":   100_000_000,
+	"PRO_MAX_PIXELS":          100_000_000,
+	"PRO_MAX_WIDTH":           16384,
+	"PRO_MAX_HEIGHT":          16384,
+	"PRO_MAX_FRAMES":          500,
+	"PRO_MAX_TOTAL_PIXELS":    400_000_000,
 }
 
 func LoadEnv(envPath string) (*Env, error) {
 	viper.AutomaticEnv()
+	for key, value := range defaults {
+		viper.SetDefault(key, value)
+	}
 
 	viper.SetConfigType("env")
 	viper.AddConfigPath(envPath)
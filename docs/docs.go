@@ -15,6 +15,132 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/deliver/{userId}/{transformations}/{filename}": {
+            "get": {
+                "description": "Transforms the image on the fly. Transformations are a comma separated list such as w_300,h_200,c_fill,a_90,e_grayscale,e_blur:2,q_80,f_auto. Animated gifs keep their animation when delivered as gif, fr_\u003cn\u003e extracts a frame and fr_poster the most detailed one. With a private bucket only public images are delivered.",
+                "produces": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/gif",
+                    "image/webp",
+                    "image/avif",
+                    "image/bmp",
+                    "image/tiff"
+                ],
+                "tags": [
+                    "delivery"
+                ],
+                "summary": "Deliver a transformed image",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Owner id",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Transformations",
+                        "name": "transformations",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Image filename",
+                        "name": "filename",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid parameters",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Image not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{key}": {
+            "get": {
+                "description": "Serves the files of the fs and memory storage drivers, image urls point here. Conditional and Range requests are supported.",
+                "produces": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/gif",
+                    "image/webp",
+                    "image/avif",
+                    "image/bmp",
+                    "image/tiff",
+                    "image/heic",
+                    "image/svg+xml",
+                    "application/pdf"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Get a stored file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Storage key",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified"
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    }
+                }
+            }
+        },
         "/images": {
             "get": {
                 "security": [
@@ -76,6 +202,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "PDF documents are accepted too, their pages are rendered on transform with the \"page\" transformation. The file is streamed to the storage, up to the configured maximum upload size.",
                 "consumes": [
                     "multipart/form-data"
                 ],
@@ -89,7 +216,7 @@ const docTemplate = `{
                 "parameters": [
                     {
                         "type": "file",
-                        "description": "Image file",
+                        "description": "Image or PDF file",
                         "name": "image",
                         "in": "formData",
                         "required": true
@@ -99,6 +226,18 @@ const docTemplate = `{
                         "description": "Image alt text",
                         "name": "alt",
                         "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return an already uploaded near-duplicate instead of storing the image again",
+                        "name": "dedupe",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Keep a public url for the image when the bucket is private",
+                        "name": "public",
+                        "in": "formData"
                     }
                 ],
                 "responses": {
@@ -126,6 +265,163 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.Error"
                         }
                     },
+                    "409": {
+                        "description": "Filename already used by a different image",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "413": {
+                        "description": "File exceeds the maximum upload size or the image size limits of the user tier",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/images/uploads": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns a ticket with a presigned url. The client uploads the file to it with a PUT request of exactly the declared size, then completes the upload. Large files don't go through the API this way.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Start a direct upload",
+                "parameters": [
+                    {
+                        "description": "File to upload",
+                        "name": "upload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.StartUploadRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadTicket"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request or unsupported format",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "413": {
+                        "description": "File exceeds the maximum upload size",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "501": {
+                        "description": "Direct uploads not supported by the storage driver",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/images/uploads/{ticket}/complete": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Validates the file uploaded with the ticket like regular uploads and creates the image. Tickets can only be completed once, unless the file was not uploaded yet.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Complete a direct upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ticket",
+                        "name": "ticket",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Image"
+                        }
+                    },
+                    "400": {
+                        "description": "File not uploaded or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Ticket not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "409": {
+                        "description": "Filename already used by a different image",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "413": {
+                        "description": "Image exceeds the size limits of the user tier",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -190,6 +486,205 @@ const docTemplate = `{
                         }
                     }
                 }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes the image and its variants. The stored content is kept while other images share it.",
+                "tags": [
+                    "images"
+                ],
+                "summary": "Delete an image",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Image id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid image id",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Image not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/images/{id}/content": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Streams the original file through the API, for private buckets and clients that can't reach the storage. Conditional requests with If-None-Match or If-Modified-Since and Range requests are supported.",
+                "produces": [
+                    "image/jpeg",
+                    "image/png",
+                    "image/gif",
+                    "image/webp",
+                    "image/avif",
+                    "image/bmp",
+                    "image/tiff",
+                    "image/heic",
+                    "image/svg+xml",
+                    "application/pdf"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Get the content of an image",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Image id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte ranges, e.g. bytes=0-1023",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified"
+                    },
+                    "400": {
+                        "description": "Invalid image id",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Image or user not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "416": {
+                        "description": "Range not satisfiable"
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/images/{id}/similar": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Images are compared by perceptual hash. The distance is the number of different bits between hashes, from 0 (identical) to 64.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Get the near-duplicates of an image",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Image id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum distance, 10 by default",
+                        "name": "distance",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.GetSimilarResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid image id or distance",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Image or user not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    }
+                }
             }
         },
         "/images/{id}/status": {
@@ -244,6 +739,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
+                "description": "The result is stored as a new variant of the image, the original upload is never modified. With the \"auto\" format the output format is negotiated from the accept field of the body, falling back to jpeg or png.",
                 "consumes": [
                     "application/json"
                 ],
@@ -253,7 +749,67 @@ const docTemplate = `{
                 "tags": [
                     "images"
                 ],
-                "summary": "Transform an image",
+                "summary": "Transform an image",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Image id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Image operations",
+                        "name": "transformations",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.TransformRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/queue.TransformationStatus"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid parameters",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/images/{id}/variants": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Get the variants of an image",
                 "parameters": [
                     {
                         "type": "integer",
@@ -261,26 +817,17 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Image operations",
-                        "name": "transformations",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handlers.TransformRequest"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/queue.TransformationStatus"
+                            "$ref": "#/definitions/handlers.GetVariantsResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid parameters",
+                        "description": "Invalid image id",
                         "schema": {
                             "$ref": "#/definitions/api.Error"
                         }
@@ -291,6 +838,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.Error"
                         }
                     },
+                    "404": {
+                        "description": "Image or user not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.Error"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -439,6 +992,28 @@ const docTemplate = `{
                 }
             }
         },
+        "handlers.GetSimilarResponse": {
+            "type": "object",
+            "properties": {
+                "images": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Image"
+                    }
+                }
+            }
+        },
+        "handlers.GetVariantsResponse": {
+            "type": "object",
+            "properties": {
+                "variants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ImageVariant"
+                    }
+                }
+            }
+        },
         "handlers.LoginResponse": {
             "type": "object",
             "properties": {
@@ -450,53 +1025,286 @@ const docTemplate = `{
                 }
             }
         },
+        "handlers.StartUploadRequest": {
+            "type": "object",
+            "required": [
+                "filename",
+                "size"
+            ],
+            "properties": {
+                "alt": {
+                    "type": "string"
+                },
+                "dedupe": {
+                    "type": "boolean"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "public": {
+                    "type": "boolean"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
         "handlers.TransformRequest": {
             "type": "object",
             "required": [
                 "transformations"
             ],
             "properties": {
+                "accept": {
+                    "description": "Accept lists the formats the \"auto\" format is negotiated against,\nlike an Accept header, e.g. \"image/avif,image/webp\".",
+                    "type": "string",
+                    "example": "image/avif,image/webp"
+                },
                 "transformations": {
                     "$ref": "#/definitions/imgproc.Transformations"
                 }
             }
         },
+        "imgproc.Animation": {
+            "type": "object",
+            "properties": {
+                "frame": {
+                    "description": "Frame extracts a single frame, starting at 1 like pdf pages.",
+                    "type": "integer",
+                    "minimum": 1
+                },
+                "poster": {
+                    "description": "Poster extracts the most detailed frame, a good static preview.",
+                    "type": "boolean"
+                }
+            }
+        },
         "imgproc.Crop": {
             "type": "object",
             "properties": {
+                "gravity": {
+                    "description": "Gravity places the crop window instead of X and Y.",
+                    "type": "string",
+                    "enum": [
+                        "center",
+                        "north",
+                        "south",
+                        "east",
+                        "west",
+                        "north-east",
+                        "north-west",
+                        "south-east",
+                        "south-west",
+                        "auto"
+                    ]
+                },
                 "height": {
-                    "type": "integer"
+                    "type": "integer",
+                    "minimum": 0
                 },
                 "width": {
-                    "type": "integer"
+                    "type": "integer",
+                    "minimum": 0
                 },
                 "x": {
-                    "type": "integer"
+                    "type": "integer",
+                    "minimum": 0
                 },
                 "y": {
-                    "type": "integer"
+                    "type": "integer",
+                    "minimum": 0
                 }
             }
         },
         "imgproc.Filters": {
             "type": "object",
             "properties": {
+                "blur": {
+                    "description": "Blur is the gaussian blur radius.",
+                    "type": "number",
+                    "maximum": 50,
+                    "minimum": 0
+                },
+                "brightness": {
+                    "description": "Brightness, Contrast and Saturation are relative changes from -1 to 1.",
+                    "type": "number",
+                    "maximum": 1,
+                    "minimum": -1
+                },
+                "contrast": {
+                    "type": "number",
+                    "maximum": 1,
+                    "minimum": -1
+                },
+                "denoise": {
+                    "description": "Denoise is the radius of the median filter.",
+                    "type": "number",
+                    "maximum": 10,
+                    "minimum": 0
+                },
+                "edgeDetection": {
+                    "description": "EdgeDetection is the radius of the edge detection kernel.",
+                    "type": "number",
+                    "maximum": 10,
+                    "minimum": 0
+                },
+                "emboss": {
+                    "type": "boolean"
+                },
+                "gamma": {
+                    "description": "Gamma is the gamma correction, 1 leaves the image unchanged.",
+                    "type": "number",
+                    "maximum": 10
+                },
                 "grayscale": {
                     "type": "boolean"
                 },
+                "hue": {
+                    "description": "Hue shifts the hue by the given degrees.",
+                    "type": "integer",
+                    "maximum": 360,
+                    "minimum": -360
+                },
+                "invert": {
+                    "type": "boolean"
+                },
+                "saturation": {
+                    "type": "number",
+                    "maximum": 1,
+                    "minimum": -1
+                },
                 "sepia": {
                     "type": "boolean"
+                },
+                "sharpen": {
+                    "type": "boolean"
+                },
+                "unsharpMask": {
+                    "$ref": "#/definitions/imgproc.UnsharpMask"
+                }
+            }
+        },
+        "imgproc.Output": {
+            "type": "object",
+            "properties": {
+                "colors": {
+                    "description": "Colors is the gif palette size, from 2 to 256.",
+                    "type": "integer",
+                    "maximum": 256,
+                    "minimum": 2
+                },
+                "compression": {
+                    "description": "Compression is default, none, fast or best for png and none or\ndeflate for tiff.",
+                    "type": "string",
+                    "enum": [
+                        "default",
+                        "none",
+                        "fast",
+                        "best",
+                        "deflate"
+                    ]
+                },
+                "dither": {
+                    "description": "Dither toggles Floyd-Steinberg dithering for gif, enabled by default.",
+                    "type": "boolean"
+                },
+                "lossless": {
+                    "description": "Lossless switches webp and avif to lossless encoding.",
+                    "type": "boolean"
+                },
+                "metadata": {
+                    "description": "Metadata is strip (default), keep or keep_icc. The EXIF data and ICC\nprofile of jpeg originals can only be kept on jpeg output.",
+                    "type": "string",
+                    "enum": [
+                        "strip",
+                        "keep",
+                        "keep_icc"
+                    ]
+                },
+                "progressive": {
+                    "description": "Progressive is not supported yet, the jpeg and png encoders only\nwrite baseline and non-interlaced images. It is rejected instead of\nbeing silently ignored.",
+                    "type": "boolean"
+                },
+                "quality": {
+                    "description": "Quality is used by jpeg, lossy webp and lossy avif, from 1 to 100.",
+                    "type": "integer",
+                    "maximum": 100,
+                    "minimum": 1
                 }
             }
         },
         "imgproc.Resize": {
             "type": "object",
             "properties": {
+                "background": {
+                    "description": "Background fills the letterbox of the contain fit. It is transparent\nby default, white for formats without alpha such as jpeg.",
+                    "type": "string"
+                },
+                "filter": {
+                    "description": "Filter is the resampling filter, linear by default.",
+                    "type": "string",
+                    "enum": [
+                        "nearest",
+                        "box",
+                        "linear",
+                        "gaussian",
+                        "mitchell",
+                        "catmullrom",
+                        "lanczos"
+                    ]
+                },
+                "fit": {
+                    "description": "Fit is only used when both dimensions are given. With a single\ndimension the other one is derived from the aspect ratio.",
+                    "type": "string",
+                    "enum": [
+                        "fill",
+                        "cover",
+                        "contain",
+                        "inside",
+                        "outside"
+                    ]
+                },
+                "gravity": {
+                    "description": "Gravity places the crop window of the cover fit, center by default.",
+                    "type": "string",
+                    "enum": [
+                        "center",
+                        "north",
+                        "south",
+                        "east",
+                        "west",
+                        "north-east",
+                        "north-west",
+                        "south-east",
+                        "south-west",
+                        "auto"
+                    ]
+                },
                 "height": {
-                    "type": "integer"
+                    "type": "integer",
+                    "minimum": 0
                 },
                 "width": {
-                    "type": "integer"
+                    "type": "integer",
+                    "minimum": 0
+                }
+            }
+        },
+        "imgproc.Step": {
+            "type": "object",
+            "required": [
+                "op"
+            ],
+            "properties": {
+                "op": {
+                    "type": "string",
+                    "enum": [
+                        "resize",
+                        "crop",
+                        "rotate",
+                        "filters",
+                        "watermark"
+                    ]
                 }
             }
         },
@@ -506,6 +1314,9 @@ const docTemplate = `{
                 "format"
             ],
             "properties": {
+                "animation": {
+                    "$ref": "#/definitions/imgproc.Animation"
+                },
                 "crop": {
                     "$ref": "#/definitions/imgproc.Crop"
                 },
@@ -515,11 +1326,121 @@ const docTemplate = `{
                 "format": {
                     "type": "string"
                 },
+                "output": {
+                    "$ref": "#/definitions/imgproc.Output"
+                },
+                "page": {
+                    "description": "Page is the page of pdf documents to render, starting at 1. Zero\nrenders the first page.",
+                    "type": "integer",
+                    "minimum": 0
+                },
                 "resize": {
                     "$ref": "#/definitions/imgproc.Resize"
                 },
                 "rotate": {
                     "type": "number"
+                },
+                "steps": {
+                    "description": "Steps is an ordered list of operations. When set, the flat fields\nabove except Format, Animation and Page are ignored and the steps run in sequence.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/imgproc.Step"
+                    }
+                },
+                "watermark": {
+                    "$ref": "#/definitions/imgproc.Watermark"
+                }
+            }
+        },
+        "imgproc.UnsharpMask": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "maximum": 10
+                },
+                "radius": {
+                    "type": "number",
+                    "maximum": 50
+                }
+            }
+        },
+        "imgproc.Watermark": {
+            "type": "object",
+            "properties": {
+                "color": {
+                    "type": "string"
+                },
+                "font": {
+                    "description": "Font is regular (default), bold, italic or mono.",
+                    "type": "string",
+                    "enum": [
+                        "regular",
+                        "bold",
+                        "italic",
+                        "mono"
+                    ]
+                },
+                "gravity": {
+                    "description": "Gravity places the watermark, south-east by default.",
+                    "type": "string",
+                    "enum": [
+                        "center",
+                        "north",
+                        "south",
+                        "east",
+                        "west",
+                        "north-east",
+                        "north-west",
+                        "south-east",
+                        "south-west"
+                    ]
+                },
+                "imageId": {
+                    "description": "ImageID is the id of the image used as overlay.",
+                    "type": "integer"
+                },
+                "offsetX": {
+                    "description": "OffsetX and OffsetY move the watermark away from the gravity edges.\nWhen tiling they are the gap between tiles.",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "offsetY": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "opacity": {
+                    "description": "Opacity goes from 0 to 1, fully opaque by default.",
+                    "type": "number",
+                    "maximum": 1
+                },
+                "scale": {
+                    "description": "Scale resizes the image overlay relative to the width of the image,\ne.g. 0.25 makes the overlay a quarter of the image width.",
+                    "type": "number",
+                    "maximum": 1
+                },
+                "size": {
+                    "description": "Size is the font size in pixels, 24 by default.",
+                    "type": "number",
+                    "maximum": 512
+                },
+                "text": {
+                    "type": "string",
+                    "maxLength": 256
+                },
+                "tile": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.GPS": {
+            "type": "object",
+            "properties": {
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
                 }
             }
         },
@@ -538,15 +1459,133 @@ const docTemplate = `{
                 "format": {
                     "type": "string"
                 },
+                "height": {
+                    "type": "integer"
+                },
                 "id": {
                     "type": "integer"
                 },
                 "imageUrl": {
                     "type": "string"
                 },
+                "metadata": {
+                    "$ref": "#/definitions/models.ImageMetadata"
+                },
+                "public": {
+                    "description": "Public images are stored under their own key, see\nstorage.PublicPrefix, and served from their public url even when the\nbucket is private. Others get presigned urls.",
+                    "type": "boolean"
+                },
+                "size": {
+                    "type": "integer"
+                },
                 "updatedAt": {
                     "type": "string"
                 },
+                "userId": {
+                    "type": "string"
+                },
+                "width": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ImageMetadata": {
+            "type": "object",
+            "properties": {
+                "cameraMake": {
+                    "type": "string"
+                },
+                "cameraModel": {
+                    "type": "string"
+                },
+                "colorModel": {
+                    "type": "string"
+                },
+                "gps": {
+                    "$ref": "#/definitions/models.GPS"
+                },
+                "hasAlpha": {
+                    "type": "boolean"
+                },
+                "pages": {
+                    "description": "Pages is the number of pages of pdf documents.",
+                    "type": "integer"
+                },
+                "palette": {
+                    "description": "Palette holds the dominant colors as hex strings, most frequent first.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "takenAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ImageVariant": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "imageId": {
+                    "type": "integer"
+                },
+                "imageUrl": {
+                    "type": "string"
+                },
+                "transformations": {
+                    "type": "object"
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.UploadTicket": {
+            "type": "object",
+            "properties": {
+                "alt": {
+                    "type": "string"
+                },
+                "dedupe": {
+                    "type": "boolean"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "public": {
+                    "type": "boolean"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "storageKey": {
+                    "description": "StorageKey is where the client uploads the file, outside of the\ncontent addressed keys.",
+                    "type": "string"
+                },
+                "ticket": {
+                    "type": "string"
+                },
+                "uploadUrl": {
+                    "type": "string"
+                },
                 "userId": {
                     "type": "string"
                 }
@@ -561,6 +1600,10 @@ const docTemplate = `{
                 "id": {
                     "type": "string"
                 },
+                "tier": {
+                    "description": "Tier selects the image size limits of the user, \"free\" by default.",
+                    "type": "string"
+                },
                 "updatedAt": {
                     "type": "string"
                 },
@@ -596,6 +1639,9 @@ const docTemplate = `{
                 },
                 "statusId": {
                     "type": "string"
+                },
+                "variantId": {
+                    "type": "integer"
                 }
             }
         }
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/edulustosa/imago/config"
+	"github.com/edulustosa/imago/internal/api"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Delivery struct {
+	Database *pgxpool.Pool
+	Env      *config.Env
+	Storage  *storage.Factory
+	Limits   imgproc.TierLimits
+}
+
+// @Summary	Deliver a transformed image
+// @Description	Transforms the image on the fly. Transformations are a comma separated list such as w_300,h_200,c_fill,a_90,e_grayscale,e_blur:2,q_80,f_auto. Animated gifs keep their animation when delivered as gif, fr_<n> extracts a frame and fr_poster the most detailed one. With a private bucket only public images are delivered.
+// @Tags		delivery
+//
+// @Produce		image/jpeg,image/png,image/gif,image/webp,image/avif,image/bmp,image/tiff
+//
+// @Param		userId path string true "Owner id"
+// @Param		transformations path string true "Transformations"
+// @Param		filename path string true "Image filename"
+//
+// @Success	200	{file} binary
+// @Failure	400	{object} api.Error "Invalid parameters"
+// @Failure	404	{object} api.Error "Image not found"
+// @Failure	500	{object} api.Error "Internal server error"
+//
+// @Router		/deliver/{userId}/{transformations}/{filename} [get]
+func (h *Delivery) Deliver(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		api.SendError(w, http.StatusBadRequest, api.Error{
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	t, err := imgproc.ParseTransformations(chi.URLParam(r, "transformations"))
+	if err != nil {
+		api.SendError(w, http.StatusBadRequest, api.Error{
+			Message: "invalid transformations",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	userRepository := user.NewRepo(h.Database)
+	imageRepository := img.NewRepo(h.Database)
+	delivery := imgproc.NewDelivery(
+		userRepository,
+		imageRepository,
+		h.Storage.ImageStorage(),
+		h.Limits,
+		h.Env.PrivateBucket,
+	)
+	imgData, format, err := delivery.Do(
+		r.Context(),
+		userID,
+		chi.URLParam(r, "filename"),
+		t,
+		r.Header.Get("Accept"),
+	)
+	if err != nil {
+		if errors.Is(err, imgproc.ErrImageNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "image not found",
+			})
+			return
+		}
+
+		if errors.Is(err, imgproc.ErrUnsupportedFormat) ||
+			errors.Is(err, imgproc.ErrInvalidOutput) ||
+			errors.Is(err, imgproc.ErrWatermarkNotFound) ||
+			errors.Is(err, imgproc.ErrFrameOutOfRange) ||
+			errors.Is(err, imgproc.ErrPageOutOfRange) ||
+			errors.Is(err, imgproc.ErrLimitExceeded) {
+			api.SendError(w, http.StatusBadRequest, api.Error{
+				Message: "invalid transformations",
+				Details: err.Error(),
+			})
+			return
+		}
+
+		api.InternalError(w, "failed to deliver image", "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", imgproc.ContentTypes[format])
+	w.Header().Set("Content-Length", strconv.Itoa(len(imgData)))
+	// Private buckets only deliver public images, so the response can be
+	// cached by shared caches either way.
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+	// The headers are sent, write errors are only logged, they are mostly
+	// clients going away.
+	if _, err := w.Write(imgData); err != nil {
+		slog.Warn("failed to write delivered image", "error", err)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/edulustosa/imago/internal/api"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+type Files struct {
+	Storage *storage.Factory
+}
+
+// @Summary	Get a stored file
+// @Description	Serves the files of the fs and memory storage drivers, image urls point here. Conditional and Range requests are supported.
+// @Tags		files
+//
+// @Param		key path string true "Storage key"
+// @Produce		image/jpeg,image/png,image/gif,image/webp,image/avif,image/bmp,image/tiff,image/heic,image/svg+xml,application/pdf
+//
+// @Success	200	{file} binary
+// @Success	206	{file} binary "Partial content"
+// @Success	304	"Not modified"
+// @Failure	404	{object} api.Error "File not found"
+// @Failure	500	{object} api.Error "Internal server error"
+//
+// @Router		/files/{key} [get]
+func (h *Files) Serve(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "*")
+
+	content, err := h.Storage.ImageStorage().DownloadImage(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, storage.ErrInvalidKey) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "file not found",
+			})
+			return
+		}
+
+		api.InternalError(w, "failed to read file", "error", err)
+		return
+	}
+	defer content.Close()
+
+	seeker, release, err := seekable(content)
+	if err != nil {
+		api.InternalError(w, "failed to read file", "error", err)
+		return
+	}
+	defer release()
+
+	// Keys have no extension, the content type is sniffed with the image
+	// decoders. Svgs are sandboxed like on the content route.
+	contentType, err := imgproc.SniffContentType(seeker)
+	if err != nil {
+		api.InternalError(w, "failed to read file", "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+storage.ContentHash(key)+`"`)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", contentMaxAge))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+
+	http.ServeContent(w, r, "", time.Time{}, seeker)
+}
+
+// seekable returns the content as an io.ReadSeeker, which http.ServeContent
+// needs to answer range requests. Contents the storage can't seek are
+// spooled to disk, release removes the spool.
+func seekable(content io.Reader) (io.ReadSeeker, func(), error) {
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		return seeker, func() {}, nil
+	}
+
+	spool, err := storage.NewSpool(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return spool.Reader(), func() { _ = spool.Close() }, nil
+}
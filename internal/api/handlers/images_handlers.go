@@ -1,18 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/edulustosa/imago/config"
 	"github.com/edulustosa/imago/internal/api"
+	"github.com/edulustosa/imago/internal/database"
 	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
 	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/upload"
 	"github.com/edulustosa/imago/internal/domain/user"
 	"github.com/edulustosa/imago/internal/queue"
 	"github.com/edulustosa/imago/internal/services/imgproc"
@@ -27,61 +31,176 @@ import (
 type Images struct {
 	Database    *pgxpool.Pool
 	Env         *config.Env
-	S3Client    *s3.Client
+	Storage     *storage.Factory
 	RedisClient *redis.Client
 	KafkaWriter *kafka.Writer
+	Limits      imgproc.TierLimits
 }
 
 // @Summary	Upload an image
+// @Description	PDF documents are accepted too, their pages are rendered on transform with the "page" transformation. The file is streamed to the storage, up to the configured maximum upload size.
 // @Tags		images
 //
 // @Accept		multipart/form-data
 // @Produce		json
 //
-// @Param		image formData file true "Image file"
+// @Param		image formData file true "Image or PDF file"
 // @Param		alt formData string false "Image alt text"
+// @Param		dedupe formData bool false "Return an already uploaded near-duplicate instead of storing the image again"
+// @Param		public formData bool false "Keep a public url for the image when the bucket is private"
 //
 // @Success	201	{object} models.Image
 // @Failure	400	{object} api.Error "Invalid request"
 // @Failure	401	{object} api.Error "Unauthorized"
 // @Failure	404	{object} api.Error "User not found"
+// @Failure	409	{object} api.Error "Filename already used by a different image"
+// @Failure	413	{object} api.Error "File exceeds the maximum upload size or the image size limits of the user tier"
 // @Failure	500	{object} api.Error "Internal server error"
 //
 // @Security	BearerAuth
 // @Router		/images [post]
 func (h *Images) Upload(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(api.UserIDKey).(uuid.UUID)
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
+	r.Body = http.MaxBytesReader(w, r.Body, h.Env.MaxUploadSize)
+
+	form, err := readUploadForm(r, "image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			api.SendError(w, http.StatusRequestEntityTooLarge, api.Error{
+				Message: "file exceeds the maximum upload size",
+			})
+			return
+		}
+
+		if errors.Is(err, errMissingFile) {
+			api.SendError(w, http.StatusBadRequest, api.Error{
+				Message: "failed to read file",
+			})
+			return
+		}
+
 		api.SendError(w, http.StatusBadRequest, api.Error{
 			Message: "failed to parse form",
 		})
 		return
 	}
+	defer form.spool.Close()
+
+	userRepository := user.NewRepo(h.Database)
+	imageRepository := img.NewRepo(h.Database)
+	contentStore := storage.NewContentStore(
+		h.Storage.ImageStorage(),
+		blob.NewRepo(h.Database),
+	)
+
+	metadata := &imgproc.ImageMetadata{
+		Filename: form.filename,
+		Format:   strings.TrimPrefix(filepath.Ext(form.filename), "."),
+		Alt:      form.values["alt"],
+		Dedupe:   form.values["dedupe"] == "true",
+		Public:   form.values["public"] == "true",
+	}
 
-	imgFile, handler, err := r.FormFile("image")
+	var imgInfo *models.Image
+	if metadata.Format == "pdf" {
+		upload := imgproc.NewDocumentUpload(userRepository, imageRepository, contentStore, h.Limits)
+		imgInfo, err = upload.DoSpool(r.Context(), userID, form.spool, metadata)
+	} else {
+		upload := imgproc.NewUpload(userRepository, imageRepository, contentStore, h.Limits)
+		imgInfo, err = upload.DoSpool(r.Context(), userID, form.spool, metadata)
+	}
 	if err != nil {
-		api.SendError(w, http.StatusBadRequest, api.Error{
-			Message: "failed to read file",
+		if errors.Is(err, imgproc.ErrUserNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "user not found",
+			})
+			return
+		}
+
+		if errors.Is(err, imgproc.ErrInvalidImage) ||
+			errors.Is(err, imgproc.ErrInvalidDocument) {
+			api.SendError(w, http.StatusBadRequest, api.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, imgproc.ErrLimitExceeded) {
+			api.SendError(w, http.StatusRequestEntityTooLarge, api.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, imgproc.ErrImageExists) {
+			api.SendError(w, http.StatusConflict, api.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		api.InternalError(w, "failed to upload image", "error", err)
+		return
+	}
+
+	if err := h.signImage(r.Context(), imgInfo); err != nil {
+		api.InternalError(w, "failed to sign image url", "error", err)
+		return
+	}
+
+	api.Encode(w, http.StatusCreated, imgInfo)
+}
+
+type StartUploadRequest struct {
+	Filename string `json:"filename" validate:"required"`
+	Size     int64  `json:"size" validate:"required,gt=0"`
+	Alt      string `json:"alt"`
+	Dedupe   bool   `json:"dedupe"`
+	Public   bool   `json:"public"`
+}
+
+// @Summary	Start a direct upload
+// @Description	Returns a ticket with a presigned url. The client uploads the file to it with a PUT request of exactly the declared size, then completes the upload. Large files don't go through the API this way.
+// @Tags		images
+//
+// @Accept		json
+// @Produce		json
+//
+// @Param		upload body StartUploadRequest true "File to upload"
+//
+// @Success	201	{object} models.UploadTicket
+// @Failure	400	{object} api.Error "Invalid request or unsupported format"
+// @Failure	401	{object} api.Error "Unauthorized"
+// @Failure	404	{object} api.Error "User not found"
+// @Failure	413	{object} api.Error "File exceeds the maximum upload size"
+// @Failure	500	{object} api.Error "Internal server error"
+// @Failure	501	{object} api.Error "Direct uploads not supported by the storage driver"
+//
+// @Security	BearerAuth
+// @Router		/images/uploads [post]
+func (h *Images) StartUpload(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(api.UserIDKey).(uuid.UUID)
+	if h.Storage.Presigner() == nil {
+		api.SendError(w, http.StatusNotImplemented, api.Error{
+			Message: "direct uploads are not supported by the storage driver",
 		})
 		return
 	}
-	defer imgFile.Close()
 
-	imgData, err := io.ReadAll(imgFile)
+	req, problems, err := api.Decode[StartUploadRequest](r)
 	if err != nil {
-		api.InternalError(w, "failed to read image", "error", err)
+		api.InvalidRequest(w, problems)
 		return
 	}
 
-	userRepository := user.NewRepo(h.Database)
-	imageRepository := img.NewRepo(h.Database)
-	s3ImageStorage := storage.NewS3ImageStorage(h.S3Client, h.Env.BucketName)
-
-	upload := imgproc.NewUpload(userRepository, imageRepository, s3ImageStorage)
-	imgInfo, err := upload.Do(r.Context(), userID, imgData, &imgproc.ImageMetadata{
-		Filename: handler.Filename,
-		Format:   strings.TrimPrefix(filepath.Ext(handler.Filename), "."),
-		Alt:      r.FormValue("alt"),
+	directUpload := h.directUpload()
+	ticket, err := directUpload.Start(r.Context(), userID, req.Size, &imgproc.ImageMetadata{
+		Filename: filepath.Base(req.Filename),
+		Format:   strings.TrimPrefix(filepath.Ext(req.Filename), "."),
+		Alt:      req.Alt,
+		Dedupe:   req.Dedupe,
+		Public:   req.Public,
 	})
 	if err != nil {
 		if errors.Is(err, imgproc.ErrUserNotFound) {
@@ -91,25 +210,126 @@ func (h *Images) Upload(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if errors.Is(err, imgproc.ErrInvalidImage) {
+		if errors.Is(err, imgproc.ErrUnsupportedFormat) {
 			api.SendError(w, http.StatusBadRequest, api.Error{
 				Message: err.Error(),
 			})
 			return
 		}
 
-		api.InternalError(w, "failed to upload image", "error", err)
+		if errors.Is(err, imgproc.ErrFileTooLarge) {
+			api.SendError(w, http.StatusRequestEntityTooLarge, api.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		api.InternalError(w, "failed to start upload", "error", err)
+		return
+	}
+
+	api.Encode(w, http.StatusCreated, ticket)
+}
+
+// @Summary	Complete a direct upload
+// @Description	Validates the file uploaded with the ticket like regular uploads and creates the image. Tickets can only be completed once, unless the file was not uploaded yet.
+// @Tags		images
+//
+// @Produce		json
+//
+// @Param		ticket path string true "Upload ticket"
+//
+// @Success	201	{object} models.Image
+// @Failure	400	{object} api.Error "File not uploaded or invalid"
+// @Failure	401	{object} api.Error "Unauthorized"
+// @Failure	404	{object} api.Error "Ticket not found"
+// @Failure	409	{object} api.Error "Filename already used by a different image"
+// @Failure	413	{object} api.Error "Image exceeds the size limits of the user tier"
+// @Failure	500	{object} api.Error "Internal server error"
+//
+// @Security	BearerAuth
+// @Router		/images/uploads/{ticket}/complete [post]
+func (h *Images) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(api.UserIDKey).(uuid.UUID)
+	ticketID, err := uuid.Parse(chi.URLParam(r, "ticket"))
+	if err != nil {
+		api.SendError(w, http.StatusNotFound, api.Error{
+			Message: "upload ticket not found",
+		})
+		return
+	}
+
+	directUpload := h.directUpload()
+	imgInfo, err := directUpload.Complete(r.Context(), userID, ticketID)
+	if err != nil {
+		if errors.Is(err, upload.ErrTicketNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, imgproc.ErrUploadNotFound) ||
+			errors.Is(err, imgproc.ErrUploadMismatch) ||
+			errors.Is(err, imgproc.ErrInvalidImage) ||
+			errors.Is(err, imgproc.ErrInvalidDocument) {
+			api.SendError(w, http.StatusBadRequest, api.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, imgproc.ErrLimitExceeded) {
+			api.SendError(w, http.StatusRequestEntityTooLarge, api.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, imgproc.ErrImageExists) {
+			api.SendError(w, http.StatusConflict, api.Error{
+				Message: err.Error(),
+			})
+			return
+		}
+
+		api.InternalError(w, "failed to complete upload", "error", err)
+		return
+	}
+
+	if err := h.signImage(r.Context(), imgInfo); err != nil {
+		api.InternalError(w, "failed to sign image url", "error", err)
 		return
 	}
 
 	api.Encode(w, http.StatusCreated, imgInfo)
 }
 
+func (h *Images) directUpload() *imgproc.DirectUpload {
+	return imgproc.NewDirectUpload(
+		user.NewRepo(h.Database),
+		img.NewRepo(h.Database),
+		upload.NewRepo(h.RedisClient),
+		h.Storage.ImageStorage(),
+		storage.NewContentStore(
+			h.Storage.ImageStorage(),
+			blob.NewRepo(h.Database),
+		),
+		h.Storage.Presigner(),
+		h.Limits,
+		h.Env.MaxUploadSize,
+	)
+}
+
 type TransformRequest struct {
 	Transformations imgproc.Transformations `json:"transformations" validate:"required"`
+	// Accept lists the formats the "auto" format is negotiated against,
+	// like an Accept header, e.g. "image/avif,image/webp".
+	Accept string `json:"accept" example:"image/avif,image/webp"`
 }
 
 // @Summary	Transform an image
+// @Description	The result is stored as a new variant of the image, the original upload is never modified. With the "auto" format the output format is negotiated from the accept field of the body, falling back to jpeg or png.
 // @Tags		images
 //
 // @Accept		json
@@ -141,11 +361,20 @@ func (h *Images) Transform(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := t.Transformations.Validate(); err != nil {
+		api.SendError(w, http.StatusBadRequest, api.Error{
+			Message: "invalid transformations",
+			Details: err.Error(),
+		})
+		return
+	}
+
 	transformationsProducer := queue.NewTransformationProducer(h.KafkaWriter, h.RedisClient)
 	processStatus, err := transformationsProducer.Enqueue(r.Context(), &queue.TransformationMessage{
 		ImageID:         imageID,
 		UserID:          userID,
 		Transformations: &t.Transformations,
+		Accept:          t.Accept,
 	})
 	if err != nil {
 		api.InternalError(w, "failed to enqueue transformation", "error", err)
@@ -181,7 +410,8 @@ func (h *Images) GetImage(w http.ResponseWriter, r *http.Request) {
 
 	userRepository := user.NewRepo(h.Database)
 	imageRepository := img.NewRepo(h.Database)
-	imageService := img.NewService(imageRepository, userRepository)
+	variantRepository := img.NewVariantRepo(h.Database)
+	imageService := img.NewService(imageRepository, userRepository, variantRepository)
 
 	imgInfo, err := imageService.GetImage(r.Context(), imageID, userID)
 	if err != nil {
@@ -198,11 +428,109 @@ func (h *Images) GetImage(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
+
+		api.InternalError(w, "failed to get image", "error", err)
+		return
+	}
+
+	if err := h.signImage(r.Context(), imgInfo); err != nil {
+		api.InternalError(w, "failed to sign image url", "error", err)
+		return
 	}
 
 	api.Encode(w, http.StatusOK, imgInfo)
 }
 
+// contentMaxAge is how long clients may cache image contents, in seconds.
+// The content of an image never changes, ETags revalidate it afterwards.
+const contentMaxAge = 86400
+
+// @Summary	Get the content of an image
+// @Description	Streams the original file through the API, for private buckets and clients that can't reach the storage. Conditional requests with If-None-Match or If-Modified-Since and Range requests are supported.
+// @Tags		images
+//
+// @Param		id path int true "Image id"
+// @Param		Range header string false "Byte ranges, e.g. bytes=0-1023"
+// @Produce		image/jpeg,image/png,image/gif,image/webp,image/avif,image/bmp,image/tiff,image/heic,image/svg+xml,application/pdf
+//
+// @Success	200	{file} binary
+// @Success	206	{file} binary "Partial content"
+// @Success	304	"Not modified"
+// @Failure	400	{object} api.Error "Invalid image id"
+// @Failure	401	{object} api.Error "Unauthorized"
+// @Failure	404	{object} api.Error "Image or user not found"
+// @Failure	416	"Range not satisfiable"
+// @Failure	500	{object} api.Error "Internal server error"
+//
+// @Security	BearerAuth
+// @Router		/images/{id}/content [get]
+func (h *Images) Content(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(api.UserIDKey).(uuid.UUID)
+	imageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		api.SendError(w, http.StatusBadRequest, api.Error{
+			Message: "invalid image id",
+		})
+		return
+	}
+
+	userRepository := user.NewRepo(h.Database)
+	imageRepository := img.NewRepo(h.Database)
+	variantRepository := img.NewVariantRepo(h.Database)
+	imageService := img.NewService(imageRepository, userRepository, variantRepository)
+
+	imgInfo, err := imageService.GetImage(r.Context(), imageID, userID)
+	if err != nil {
+		if errors.Is(err, img.ErrImageNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "image not found",
+			})
+			return
+		}
+
+		if errors.Is(err, img.ErrUserNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "user not found",
+			})
+			return
+		}
+
+		api.InternalError(w, "failed to get image", "error", err)
+		return
+	}
+
+	content, err := h.Storage.ImageStorage().DownloadImage(r.Context(), imgInfo.StorageKey)
+	if err != nil {
+		api.InternalError(w, "failed to download image", "error", err)
+		return
+	}
+	defer content.Close()
+
+	seeker, release, err := seekable(content)
+	if err != nil {
+		api.InternalError(w, "failed to download image", "error", err)
+		return
+	}
+	defer release()
+
+	cacheControl := fmt.Sprintf("private, max-age=%d", contentMaxAge)
+	if imgInfo.Public {
+		cacheControl = fmt.Sprintf("public, max-age=%d", contentMaxAge)
+	}
+
+	if contentType, ok := imgproc.ContentTypes[imgInfo.Format]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("ETag", `"`+storage.ContentHash(imgInfo.StorageKey)+`"`)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if imgInfo.Format == "svg" {
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	}
+
+	http.ServeContent(w, r, "", imgInfo.UpdatedAt, seeker)
+}
+
 type GetImagesResponse struct {
 	Images []models.Image `json:"images"`
 }
@@ -235,7 +563,8 @@ func (h *Images) GetImages(w http.ResponseWriter, r *http.Request) {
 
 	userRepository := user.NewRepo(h.Database)
 	imageRepository := img.NewRepo(h.Database)
-	imageService := img.NewService(imageRepository, userRepository)
+	variantRepository := img.NewVariantRepo(h.Database)
+	imageService := img.NewService(imageRepository, userRepository, variantRepository)
 
 	imgs, err := imageService.GetImages(r.Context(), userID, page, limit)
 	if err != nil {
@@ -250,5 +579,313 @@ func (h *Images) GetImages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.signImages(r.Context(), imgs); err != nil {
+		api.InternalError(w, "failed to sign image urls", "error", err)
+		return
+	}
+
 	api.Encode(w, http.StatusOK, GetImagesResponse{imgs})
 }
+
+type GetVariantsResponse struct {
+	Variants []models.ImageVariant `json:"variants"`
+}
+
+// @Summary	Get the variants of an image
+// @Tags		images
+//
+// @Param		id path int true "Image id"
+// @Produce		json
+//
+// @Success	200	{object} GetVariantsResponse
+// @Failure	400	{object} api.Error "Invalid image id"
+// @Failure	401	{object} api.Error "Unauthorized"
+// @Failure	404	{object} api.Error "Image or user not found"
+// @Failure	500	{object} api.Error "Internal server error"
+//
+// @Security	BearerAuth
+// @Router		/images/{id}/variants [get]
+func (h *Images) GetVariants(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(api.UserIDKey).(uuid.UUID)
+	imageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		api.SendError(w, http.StatusBadRequest, api.Error{
+			Message: "invalid image id",
+		})
+		return
+	}
+
+	userRepository := user.NewRepo(h.Database)
+	imageRepository := img.NewRepo(h.Database)
+	variantRepository := img.NewVariantRepo(h.Database)
+	imageService := img.NewService(imageRepository, userRepository, variantRepository)
+
+	variants, err := imageService.GetVariants(r.Context(), imageID, userID)
+	if err != nil {
+		if errors.Is(err, img.ErrImageNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "image not found",
+			})
+			return
+		}
+
+		if errors.Is(err, img.ErrUserNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "user not found",
+			})
+			return
+		}
+
+		api.InternalError(w, "failed to get image variants", "error", err)
+		return
+	}
+
+	if err := h.signVariants(r.Context(), variants); err != nil {
+		api.InternalError(w, "failed to sign variant urls", "error", err)
+		return
+	}
+
+	api.Encode(w, http.StatusOK, GetVariantsResponse{variants})
+}
+
+type GetSimilarResponse struct {
+	Images []models.Image `json:"images"`
+}
+
+// @Summary	Get the near-duplicates of an image
+// @Description	Images are compared by perceptual hash. The distance is the number of different bits between hashes, from 0 (identical) to 64.
+// @Tags		images
+//
+// @Param		id path int true "Image id"
+// @Param		distance query int false "Maximum distance, 10 by default"
+// @Produce		json
+//
+// @Success	200	{object} GetSimilarResponse
+// @Failure	400	{object} api.Error "Invalid image id or distance"
+// @Failure	401	{object} api.Error "Unauthorized"
+// @Failure	404	{object} api.Error "Image or user not found"
+// @Failure	500	{object} api.Error "Internal server error"
+//
+// @Security	BearerAuth
+// @Router		/images/{id}/similar [get]
+func (h *Images) GetSimilar(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(api.UserIDKey).(uuid.UUID)
+	imageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		api.SendError(w, http.StatusBadRequest, api.Error{
+			Message: "invalid image id",
+		})
+		return
+	}
+
+	distance := 10
+	if d := r.URL.Query().Get("distance"); d != "" {
+		distance, err = strconv.Atoi(d)
+		if err != nil || distance < 0 || distance > 64 {
+			api.SendError(w, http.StatusBadRequest, api.Error{
+				Message: "distance must be between 0 and 64",
+			})
+			return
+		}
+	}
+
+	userRepository := user.NewRepo(h.Database)
+	imageRepository := img.NewRepo(h.Database)
+	variantRepository := img.NewVariantRepo(h.Database)
+	imageService := img.NewService(imageRepository, userRepository, variantRepository)
+
+	imgs, err := imageService.GetSimilar(r.Context(), imageID, userID, distance)
+	if err != nil {
+		if errors.Is(err, img.ErrImageNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "image not found",
+			})
+			return
+		}
+
+		if errors.Is(err, img.ErrUserNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "user not found",
+			})
+			return
+		}
+
+		api.InternalError(w, "failed to get similar images", "error", err)
+		return
+	}
+
+	if err := h.signImages(r.Context(), imgs); err != nil {
+		api.InternalError(w, "failed to sign image urls", "error", err)
+		return
+	}
+
+	api.Encode(w, http.StatusOK, GetSimilarResponse{imgs})
+}
+
+// @Summary	Delete an image
+// @Description	Deletes the image and its variants. The stored content is kept while other images share it.
+// @Tags		images
+//
+// @Param		id path int true "Image id"
+//
+// @Success	204
+// @Failure	400	{object} api.Error "Invalid image id"
+// @Failure	401	{object} api.Error "Unauthorized"
+// @Failure	404	{object} api.Error "Image not found"
+// @Failure	500	{object} api.Error "Internal server error"
+//
+// @Security	BearerAuth
+// @Router		/images/{id} [delete]
+func (h *Images) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(api.UserIDKey).(uuid.UUID)
+	imageID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		api.SendError(w, http.StatusBadRequest, api.Error{
+			Message: "invalid image id",
+		})
+		return
+	}
+
+	contentStore := storage.NewContentStore(
+		h.Storage.ImageStorage(),
+		blob.NewRepo(h.Database),
+	)
+
+	deletion := imgproc.NewDeletion(
+		database.NewTransactor(h.Database),
+		img.NewRepo(h.Database),
+		img.NewVariantRepo(h.Database),
+		contentStore,
+	)
+	if err := deletion.Do(r.Context(), imageID, userID); err != nil {
+		if errors.Is(err, imgproc.ErrImageNotFound) {
+			api.SendError(w, http.StatusNotFound, api.Error{
+				Message: "image not found",
+			})
+			return
+		}
+
+		api.InternalError(w, "failed to delete image", "error", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// signImage replaces the url of the image with a presigned url when the
+// bucket is private. Public images keep their public url.
+func (h *Images) signImage(ctx context.Context, imgInfo *models.Image) error {
+	if !h.signsURLs() || imgInfo.Public {
+		return nil
+	}
+
+	url, err := h.presignDownload(ctx, imgInfo.StorageKey)
+	if err != nil {
+		return err
+	}
+
+	imgInfo.ImageURL = url
+	return nil
+}
+
+func (h *Images) signImages(ctx context.Context, images []models.Image) error {
+	for i := range images {
+		if err := h.signImage(ctx, &images[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signVariants presigns the urls of the variants when the bucket is
+// private, whether their image is public or not.
+func (h *Images) signVariants(ctx context.Context, variants []models.ImageVariant) error {
+	if !h.signsURLs() {
+		return nil
+	}
+
+	for i := range variants {
+		url, err := h.presignDownload(ctx, variants[i].StorageKey)
+		if err != nil {
+			return err
+		}
+
+		variants[i].ImageURL = url
+	}
+
+	return nil
+}
+
+// signsURLs reports whether urls are presigned. Drivers without a presigner
+// serve their files publicly, the server refuses to start with a private
+// bucket on them.
+func (h *Images) signsURLs() bool {
+	return h.Env.PrivateBucket && h.Storage.Presigner() != nil
+}
+
+func (h *Images) presignDownload(ctx context.Context, key string) (string, error) {
+	return h.Storage.Presigner().PresignDownload(ctx, key, h.Env.SignedURLExpiry)
+}
+
+// maxFormValueSize bounds the form fields sent along the file.
+const maxFormValueSize = 1 << 10
+
+var errMissingFile = errors.New("missing file")
+
+// uploadForm is a multipart form read as a stream. The file is spooled to
+// disk instead of being kept in memory.
+type uploadForm struct {
+	spool    *storage.Spool
+	filename string
+	values   map[string]string
+}
+
+// readUploadForm reads the multipart form of the request, spooling the
+// first file sent in the field. Other fields are read as values, whatever
+// their order.
+func readUploadForm(r *http.Request, field string) (*uploadForm, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	form := &uploadForm{values: map[string]string{}}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			form.close()
+			return nil, err
+		}
+
+		if part.FormName() == field && part.FileName() != "" && form.spool == nil {
+			form.filename = part.FileName()
+			form.spool, err = storage.NewSpool(part)
+		} else {
+			var value []byte
+			value, err = io.ReadAll(io.LimitReader(part, maxFormValueSize))
+			form.values[part.FormName()] = string(value)
+		}
+		part.Close()
+
+		if err != nil {
+			form.close()
+			return nil, err
+		}
+	}
+
+	if form.spool == nil {
+		return nil, errMissingFile
+	}
+
+	return form, nil
+}
+
+func (f *uploadForm) close() {
+	if f.spool != nil {
+		_ = f.spool.Close()
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/edulustosa/imago/config"
 	"github.com/edulustosa/imago/internal/api/handlers"
 	"github.com/edulustosa/imago/internal/api/middlewares"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httprate"
@@ -22,9 +23,10 @@ import (
 type Server struct {
 	Database    *pgxpool.Pool
 	Env         *config.Env
-	S3Client    *s3.Client
+	Storage     *storage.Factory
 	RedisClient *redis.Client
 	KafkaWriter *kafka.Writer
+	Limits      imgproc.TierLimits
 }
 
 //	@title			Imago API
@@ -50,6 +52,25 @@ func New(srv Server) http.Handler {
 	r.Post("/register", authHandlers.Register)
 	r.Post("/login", authHandlers.Login)
 
+	deliveryHandler := &handlers.Delivery{
+		Database: srv.Database,
+		Env:      srv.Env,
+		Storage:  srv.Storage,
+		Limits:   srv.Limits,
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(httprate.LimitByIP(60, 1*time.Minute))
+
+		r.Get("/deliver/{userId}/{transformations}/{filename}", deliveryHandler.Deliver)
+	})
+
+	// Files of the local drivers, S3 serves its own.
+	if srv.Env.StorageDriver != storage.DriverS3 {
+		filesHandler := &handlers.Files{Storage: srv.Storage}
+		r.Get("/files/*", filesHandler.Serve)
+	}
+
 	authMiddleware := &middlewares.AuthMiddleware{Env: srv.Env}
 	// Authenticated routes
 	r.Group(func(r chi.Router) {
@@ -58,13 +79,18 @@ func New(srv Server) http.Handler {
 		imagesHandler := &handlers.Images{
 			Database:    srv.Database,
 			Env:         srv.Env,
-			S3Client:    srv.S3Client,
+			Storage:     srv.Storage,
 			RedisClient: srv.RedisClient,
 			KafkaWriter: srv.KafkaWriter,
+			Limits:      srv.Limits,
 		}
 
 		r.Get("/images/{id}", imagesHandler.GetImage)
+		r.Get("/images/{id}/content", imagesHandler.Content)
+		r.Delete("/images/{id}", imagesHandler.Delete)
 		r.Get("/images", imagesHandler.GetImages)
+		r.Get("/images/{id}/variants", imagesHandler.GetVariants)
+		r.Get("/images/{id}/similar", imagesHandler.GetSimilar)
 		r.Get("/images/{id}/status", handlers.GetTransformationStatus(srv.RedisClient))
 
 		r.Group(func(r chi.Router) {
@@ -75,6 +101,8 @@ func New(srv Server) http.Handler {
 			))
 
 			r.Post("/images", imagesHandler.Upload)
+			r.Post("/images/uploads", imagesHandler.StartUpload)
+			r.Post("/images/uploads/{ticket}/complete", imagesHandler.CompleteUpload)
 			r.Post("/images/{id}/transform", imagesHandler.Transform)
 		})
 	})
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS image_variants (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "image_id" INTEGER NOT NULL,
+    "user_id" UUID NOT NULL,
+    "image_url" TEXT NOT NULL,
+    "filename" VARCHAR(255) NOT NULL,
+    "format" VARCHAR(10) NOT NULL,
+    "transformations" JSONB NOT NULL,
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS image_variants_image_id_idx ON image_variants (image_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS image_variants;
+-- +goose StatementEnd
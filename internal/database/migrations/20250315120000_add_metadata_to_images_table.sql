@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE images
+    ADD COLUMN IF NOT EXISTS "width" INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS "height" INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS "size" BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS "metadata" JSONB NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE images
+    DROP COLUMN IF EXISTS "width",
+    DROP COLUMN IF EXISTS "height",
+    DROP COLUMN IF EXISTS "size",
+    DROP COLUMN IF EXISTS "metadata";
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS blobs (
+    "key" TEXT PRIMARY KEY NOT NULL,
+    "size" BIGINT NOT NULL DEFAULT 0,
+    "ref_count" INTEGER NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE images ADD COLUMN IF NOT EXISTS "storage_key" TEXT NOT NULL DEFAULT '';
+ALTER TABLE image_variants ADD COLUMN IF NOT EXISTS "storage_key" TEXT NOT NULL DEFAULT '';
+
+-- Objects uploaded before content addressing keep their path as key.
+UPDATE images SET storage_key = user_id || '/' || filename WHERE storage_key = '';
+UPDATE image_variants
+SET storage_key = user_id || '/variants/' || image_id || '/' || filename
+WHERE storage_key = '';
+
+INSERT INTO blobs (key, size, ref_count)
+SELECT storage_key, 0, COUNT(*) FROM (
+    SELECT storage_key FROM images
+    UNION ALL
+    SELECT storage_key FROM image_variants
+) AS objects
+GROUP BY storage_key
+ON CONFLICT (key) DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE image_variants DROP COLUMN IF EXISTS "storage_key";
+ALTER TABLE images DROP COLUMN IF EXISTS "storage_key";
+DROP TABLE IF EXISTS blobs;
+-- +goose StatementEnd
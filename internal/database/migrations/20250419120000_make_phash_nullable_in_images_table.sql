@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A hash of 0 is a valid dHash, images without a hash are NULL instead. Rows
+-- hashed 0 so far were uploaded before hashes were computed.
+ALTER TABLE images ALTER COLUMN "phash" DROP NOT NULL;
+ALTER TABLE images ALTER COLUMN "phash" DROP DEFAULT;
+UPDATE images SET "phash" = NULL WHERE "phash" = 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE images SET "phash" = 0 WHERE "phash" IS NULL;
+ALTER TABLE images ALTER COLUMN "phash" SET DEFAULT 0;
+ALTER TABLE images ALTER COLUMN "phash" SET NOT NULL;
+-- +goose StatementEnd
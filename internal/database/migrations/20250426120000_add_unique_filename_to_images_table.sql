@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Filenames identify the images of a user, e.g. in delivery urls. Duplicates
+-- left by concurrent uploads keep their filename on the oldest image, the
+-- others get their id appended.
+UPDATE images SET "filename" = "filename" || '_' || "id"
+WHERE "id" NOT IN (SELECT MIN("id") FROM images GROUP BY "user_id", "filename");
+CREATE UNIQUE INDEX IF NOT EXISTS images_user_id_filename_key ON images ("user_id", "filename");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS images_user_id_filename_key;
+-- +goose StatementEnd
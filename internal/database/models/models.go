@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,6 +13,8 @@ type User struct {
 	PasswordHash string    `json:"-"`
 	CreatedAt    time.Time `json:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt"`
+	// Tier selects the image size limits of the user, "free" by default.
+	Tier string `json:"tier"`
 }
 
 type Image struct {
@@ -23,4 +26,69 @@ type Image struct {
 	Alt       string    `json:"alt"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
+
+	Width    int           `json:"width"`
+	Height   int           `json:"height"`
+	Size     int64         `json:"size"`
+	Metadata ImageMetadata `json:"metadata"`
+	// PHash is the perceptual hash used to find near-duplicates, nil for
+	// images uploaded before hashes were computed.
+	PHash *int64 `json:"-"`
+	// StorageKey is the key of the image content in the storage, derived
+	// from its hash. The filename is only kept as metadata.
+	StorageKey string `json:"-"`
+	// Public images are stored under their own key, see
+	// storage.PublicPrefix, and served from their public url even when the
+	// bucket is private. Others get presigned urls.
+	Public bool `json:"public"`
+}
+
+// ImageMetadata is extracted from the image on upload.
+type ImageMetadata struct {
+	ColorModel string `json:"colorModel"`
+	HasAlpha   bool   `json:"hasAlpha"`
+	// Palette holds the dominant colors as hex strings, most frequent first.
+	Palette []string `json:"palette"`
+	// Pages is the number of pages of pdf documents.
+	Pages int `json:"pages,omitempty"`
+
+	CameraMake  string     `json:"cameraMake,omitempty"`
+	CameraModel string     `json:"cameraModel,omitempty"`
+	TakenAt     *time.Time `json:"takenAt,omitempty"`
+	GPS         *GPS       `json:"gps,omitempty"`
+}
+
+type GPS struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type ImageVariant struct {
+	ID              int             `json:"id"`
+	ImageID         int             `json:"imageId"`
+	UserID          uuid.UUID       `json:"userId"`
+	ImageURL        string          `json:"imageUrl"`
+	Filename        string          `json:"filename"`
+	Format          string          `json:"format"`
+	Transformations json.RawMessage `json:"transformations" swaggertype:"object"`
+	CreatedAt       time.Time       `json:"createdAt"`
+	StorageKey      string          `json:"-"`
+}
+
+// UploadTicket tracks an upload sent by the client straight to the storage,
+// until it is completed and becomes an image.
+type UploadTicket struct {
+	ID        uuid.UUID `json:"ticket"`
+	UserID    uuid.UUID `json:"userId"`
+	Filename  string    `json:"filename"`
+	Format    string    `json:"format"`
+	Alt       string    `json:"alt"`
+	Dedupe    bool      `json:"dedupe"`
+	Public    bool      `json:"public"`
+	Size      int64     `json:"size"`
+	UploadURL string    `json:"uploadUrl"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// StorageKey is where the client uploads the file, outside of the
+	// content addressed keys.
+	StorageKey string `json:"storageKey"`
 }
@@ -0,0 +1,132 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/edulustosa/imago/internal/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Repository counts the references to the objects of the content
+// addressed storage. It satisfies storage.RefCounter.
+type Repository interface {
+	Acquire(ctx context.Context, key string, size int64) (int, error)
+	Release(ctx context.Context, key string, unreferenced func() error) (int, error)
+}
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+type repo struct {
+	db *pgxpool.Pool
+}
+
+func NewRepo(db *pgxpool.Pool) Repository {
+	return &repo{db}
+}
+
+const acquire = `
+	INSERT INTO blobs (key, size, ref_count)
+	VALUES ($1, $2, 1)
+	ON CONFLICT (key) DO UPDATE SET ref_count = blobs.ref_count + 1
+	RETURNING ref_count
+`
+
+func (r *repo) Acquire(ctx context.Context, key string, size int64) (int, error) {
+	var refs int
+	if err := r.db.QueryRow(ctx, acquire, key, size).Scan(&refs); err != nil {
+		return 0, fmt.Errorf("failed to acquire blob: %w", err)
+	}
+
+	return refs, nil
+}
+
+const lockBlob = "SELECT ref_count FROM blobs WHERE key = $1 FOR UPDATE"
+
+const release = "UPDATE blobs SET ref_count = ref_count - 1 WHERE key = $1"
+
+const deleteBlob = "DELETE FROM blobs WHERE key = $1"
+
+// Release locks the row of the key, so the count can't change until the
+// last reference is removed together with the row. Acquires of the key
+// block on the lock and then create a new row. Within a transaction of the
+// context the release is a savepoint, the lock is held until it commits.
+func (r *repo) Release(ctx context.Context, key string, unreferenced func() error) (int, error) {
+	tx, err := database.Conn(ctx, r.db).Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release blob: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var refs int
+	err = tx.QueryRow(ctx, lockBlob, key).Scan(&refs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrBlobNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to release blob: %w", err)
+	}
+
+	if refs > 1 {
+		if _, err := tx.Exec(ctx, release, key); err != nil {
+			return 0, fmt.Errorf("failed to release blob: %w", err)
+		}
+
+		return refs - 1, tx.Commit(ctx)
+	}
+
+	if _, err := tx.Exec(ctx, deleteBlob, key); err != nil {
+		return 0, fmt.Errorf("failed to delete blob: %w", err)
+	}
+
+	if err := unreferenced(); err != nil {
+		return 0, err
+	}
+
+	return 0, tx.Commit(ctx)
+}
+
+type MemoryRepo struct {
+	mu   sync.Mutex
+	Refs map[string]int
+}
+
+var _ Repository = (*MemoryRepo)(nil)
+
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{Refs: make(map[string]int)}
+}
+
+func (r *MemoryRepo) Acquire(_ context.Context, key string, _ int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Refs[key]++
+	return r.Refs[key], nil
+}
+
+func (r *MemoryRepo) Release(_ context.Context, key string, unreferenced func() error) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	refs, ok := r.Refs[key]
+	if !ok {
+		return 0, ErrBlobNotFound
+	}
+
+	if refs <= 1 {
+		if err := unreferenced(); err != nil {
+			return 0, err
+		}
+
+		delete(r.Refs, key)
+		return 0, nil
+	}
+
+	r.Refs[key] = refs - 1
+	return refs - 1, nil
+}
@@ -2,22 +2,37 @@ package img
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/bits"
 	"sort"
 	"time"
 
+	"github.com/edulustosa/imago/internal/database"
 	"github.com/edulustosa/imago/internal/database/models"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrFilenameTaken is returned when creating an image under a filename the
+// user already has, filenames are unique per user.
+var ErrFilenameTaken = errors.New("filename already used by another image")
+
+// uniqueViolation is the postgres error code of unique constraint violations.
+const uniqueViolation = "23505"
+
 type Repository interface {
 	FindByID(ctx context.Context, id int, userID uuid.UUID) (*models.Image, error)
+	// Create fails with ErrFilenameTaken when the user already has an image
+	// with the filename.
 	Create(ctx context.Context, imgInfo models.Image) (*models.Image, error)
 	FindByFilename(ctx context.Context, filename string, userID uuid.UUID) (*models.Image, error)
 	Update(ctx context.Context, id int, userID uuid.UUID, imgInfo models.Image) (*models.Image, error)
 	FindManyByUserID(ctx context.Context, userID uuid.UUID, page, limit int) ([]models.Image, error)
+	FindSimilar(ctx context.Context, userID uuid.UUID, phash int64, maxDistance int) ([]models.Image, error)
+	Delete(ctx context.Context, id int, userID uuid.UUID) error
 }
 
 type repo struct {
@@ -39,6 +54,13 @@ func scanImage(row pgx.Row) (*models.Image, error) {
 		&img.Alt,
 		&img.CreatedAt,
 		&img.UpdatedAt,
+		&img.Width,
+		&img.Height,
+		&img.Size,
+		&img.Metadata,
+		&img.PHash,
+		&img.StorageKey,
+		&img.Public,
 	)
 
 	return &img, err
@@ -67,8 +89,15 @@ const create = `
 		image_url,
 		filename,
 		format,
-		alt	
-	) VALUES ($1, $2, $3, $4, $5)
+		alt,
+		width,
+		height,
+		size,
+		metadata,
+		phash,
+		storage_key,
+		public
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	RETURNING *
 `
 
@@ -81,10 +110,22 @@ func (r *repo) Create(ctx context.Context, img models.Image) (*models.Image, err
 		img.Filename,
 		img.Format,
 		img.Alt,
+		img.Width,
+		img.Height,
+		img.Size,
+		img.Metadata,
+		img.PHash,
+		img.StorageKey,
+		img.Public,
 	)
 
 	imgInfo, err := scanImage(row)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, ErrFilenameTaken
+		}
+
 		return nil, fmt.Errorf("failed to create image: %w", err)
 	}
 
@@ -174,6 +215,55 @@ func (r *repo) FindManyByUserID(
 	return images, nil
 }
 
+// Images without a hash, uploaded before hashes were computed, are ignored.
+const findSimilar = `
+	SELECT * FROM images
+	WHERE user_id = $1
+		AND phash IS NOT NULL
+		AND bit_count((phash # $2)::bit(64)) <= $3
+	ORDER BY bit_count((phash # $2)::bit(64)), created_at DESC
+`
+
+func (r *repo) FindSimilar(
+	ctx context.Context,
+	userID uuid.UUID,
+	phash int64,
+	maxDistance int,
+) ([]models.Image, error) {
+	rows, err := r.db.Query(ctx, findSimilar, userID, phash, maxDistance)
+	if err != nil {
+		return nil, fmt.Errorf("could not query similar images: %w", err)
+	}
+	defer rows.Close()
+
+	images := []models.Image{}
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, *img)
+	}
+
+	return images, rows.Err()
+}
+
+const deleteImage = "DELETE FROM images WHERE id = $1 AND user_id = $2"
+
+func (r *repo) Delete(ctx context.Context, id int, userID uuid.UUID) error {
+	tag, err := database.Conn(ctx, r.db).Exec(ctx, deleteImage, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete image: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete image: not found")
+	}
+
+	return nil
+}
+
 type MemoryRepo struct {
 	Images []models.Image
 }
@@ -202,6 +292,12 @@ func (r *MemoryRepo) Create(
 	_ context.Context,
 	img models.Image,
 ) (*models.Image, error) {
+	for _, existing := range r.Images {
+		if existing.Filename == img.Filename && existing.UserID == img.UserID {
+			return nil, ErrFilenameTaken
+		}
+	}
+
 	img.ID = len(r.Images) + 1
 	img.CreatedAt = time.Now()
 	img.UpdatedAt = time.Now()
@@ -274,3 +370,38 @@ func (r *MemoryRepo) FindManyByUserID(
 
 	return images[start:end], nil
 }
+
+func (r *MemoryRepo) FindSimilar(
+	_ context.Context,
+	userID uuid.UUID,
+	phash int64,
+	maxDistance int,
+) ([]models.Image, error) {
+	images := []models.Image{}
+	for _, img := range r.Images {
+		if img.UserID == userID && img.PHash != nil && hammingDistance(*img.PHash, phash) <= maxDistance {
+			images = append(images, img)
+		}
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		return hammingDistance(*images[i].PHash, phash) < hammingDistance(*images[j].PHash, phash)
+	})
+
+	return images, nil
+}
+
+func hammingDistance(a, b int64) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+func (r *MemoryRepo) Delete(_ context.Context, id int, userID uuid.UUID) error {
+	for i, img := range r.Images {
+		if img.ID == id && img.UserID == userID {
+			r.Images = append(r.Images[:i], r.Images[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to delete image")
+}
@@ -3,6 +3,7 @@ package img
 import (
 	"context"
 	"errors"
+	"slices"
 
 	"github.com/edulustosa/imago/internal/database/models"
 	"github.com/edulustosa/imago/internal/domain/user"
@@ -10,14 +11,20 @@ import (
 )
 
 type Service struct {
-	repo           Repository
-	userRepository user.Repository
+	repo              Repository
+	userRepository    user.Repository
+	variantRepository VariantRepository
 }
 
-func NewService(repo Repository, userRepository user.Repository) *Service {
+func NewService(
+	repo Repository,
+	userRepository user.Repository,
+	variantRepository VariantRepository,
+) *Service {
 	return &Service{
 		repo,
 		userRepository,
+		variantRepository,
 	}
 }
 
@@ -56,3 +63,43 @@ func (s *Service) GetImages(
 
 	return s.repo.FindManyByUserID(ctx, user.ID, page, limit)
 }
+
+func (s *Service) GetVariants(
+	ctx context.Context,
+	imgID int,
+	userID uuid.UUID,
+) ([]models.ImageVariant, error) {
+	img, err := s.GetImage(ctx, imgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.variantRepository.FindManyByImageID(ctx, img.ID, img.UserID)
+}
+
+// GetSimilar returns the near-duplicates of the image, closest first. The
+// distance is the Hamming distance between perceptual hashes, from 0 to 64.
+func (s *Service) GetSimilar(
+	ctx context.Context,
+	imgID int,
+	userID uuid.UUID,
+	maxDistance int,
+) ([]models.Image, error) {
+	img, err := s.GetImage(ctx, imgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if img.PHash == nil {
+		return []models.Image{}, nil
+	}
+
+	images, err := s.repo.FindSimilar(ctx, img.UserID, *img.PHash, maxDistance)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(images, func(similar models.Image) bool {
+		return similar.ID == img.ID
+	}), nil
+}
@@ -0,0 +1,205 @@
+package img
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/edulustosa/imago/internal/database"
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type VariantRepository interface {
+	Create(ctx context.Context, variant models.ImageVariant) (*models.ImageVariant, error)
+	FindManyByImageID(ctx context.Context, imageID int, userID uuid.UUID) ([]models.ImageVariant, error)
+	// DeleteManyByImageID deletes the variants of the image and returns
+	// them, so their content can be released.
+	DeleteManyByImageID(ctx context.Context, imageID int, userID uuid.UUID) ([]models.ImageVariant, error)
+}
+
+type variantRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewVariantRepo(db *pgxpool.Pool) VariantRepository {
+	return &variantRepo{db}
+}
+
+func scanVariant(row pgx.Row) (*models.ImageVariant, error) {
+	var variant models.ImageVariant
+	err := row.Scan(
+		&variant.ID,
+		&variant.ImageID,
+		&variant.UserID,
+		&variant.ImageURL,
+		&variant.Filename,
+		&variant.Format,
+		&variant.Transformations,
+		&variant.CreatedAt,
+		&variant.StorageKey,
+	)
+
+	return &variant, err
+}
+
+const createVariant = `
+	INSERT INTO image_variants (
+		image_id,
+		user_id,
+		image_url,
+		filename,
+		format,
+		transformations,
+		storage_key
+	) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING *
+`
+
+func (r *variantRepo) Create(
+	ctx context.Context,
+	variant models.ImageVariant,
+) (*models.ImageVariant, error) {
+	row := r.db.QueryRow(
+		ctx,
+		createVariant,
+		variant.ImageID,
+		variant.UserID,
+		variant.ImageURL,
+		variant.Filename,
+		variant.Format,
+		variant.Transformations,
+		variant.StorageKey,
+	)
+
+	v, err := scanVariant(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image variant: %w", err)
+	}
+
+	return v, nil
+}
+
+const findVariantsByImageID = `
+	SELECT * FROM image_variants
+	WHERE image_id = $1 AND user_id = $2
+	ORDER BY created_at DESC
+`
+
+func (r *variantRepo) FindManyByImageID(
+	ctx context.Context,
+	imageID int,
+	userID uuid.UUID,
+) ([]models.ImageVariant, error) {
+	rows, err := r.db.Query(ctx, findVariantsByImageID, imageID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not query image variants: %w", err)
+	}
+	defer rows.Close()
+
+	variants := []models.ImageVariant{}
+	for rows.Next() {
+		v, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, *v)
+	}
+
+	return variants, rows.Err()
+}
+
+const deleteVariantsByImageID = `
+	DELETE FROM image_variants WHERE image_id = $1 AND user_id = $2
+	RETURNING *
+`
+
+func (r *variantRepo) DeleteManyByImageID(
+	ctx context.Context,
+	imageID int,
+	userID uuid.UUID,
+) ([]models.ImageVariant, error) {
+	rows, err := database.Conn(ctx, r.db).Query(ctx, deleteVariantsByImageID, imageID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete image variants: %w", err)
+	}
+	defer rows.Close()
+
+	variants := []models.ImageVariant{}
+	for rows.Next() {
+		v, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, *v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete image variants: %w", err)
+	}
+
+	return variants, nil
+}
+
+type MemoryVariantRepo struct {
+	Variants []models.ImageVariant
+}
+
+var _ VariantRepository = (*MemoryVariantRepo)(nil)
+
+func NewMemoryVariantRepo() *MemoryVariantRepo {
+	return &MemoryVariantRepo{}
+}
+
+func (r *MemoryVariantRepo) Create(
+	_ context.Context,
+	variant models.ImageVariant,
+) (*models.ImageVariant, error) {
+	variant.ID = len(r.Variants) + 1
+	variant.CreatedAt = time.Now()
+
+	r.Variants = append(r.Variants, variant)
+	return &variant, nil
+}
+
+func (r *MemoryVariantRepo) FindManyByImageID(
+	_ context.Context,
+	imageID int,
+	userID uuid.UUID,
+) ([]models.ImageVariant, error) {
+	variants := []models.ImageVariant{}
+	for _, v := range r.Variants {
+		if v.ImageID == imageID && v.UserID == userID {
+			variants = append(variants, v)
+		}
+	}
+
+	sort.Slice(variants, func(i, j int) bool {
+		return variants[i].CreatedAt.After(variants[j].CreatedAt)
+	})
+
+	return variants, nil
+}
+
+func (r *MemoryVariantRepo) DeleteManyByImageID(
+	_ context.Context,
+	imageID int,
+	userID uuid.UUID,
+) ([]models.ImageVariant, error) {
+	deleted := []models.ImageVariant{}
+	r.Variants = slices.DeleteFunc(r.Variants, func(v models.ImageVariant) bool {
+		if v.ImageID == imageID && v.UserID == userID {
+			deleted = append(deleted, v)
+			return true
+		}
+		return false
+	})
+
+	return deleted, nil
+}
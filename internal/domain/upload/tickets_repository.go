@@ -0,0 +1,105 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrTicketNotFound = errors.New("upload ticket not found")
+
+// Repository keeps upload tickets until they are claimed or expire.
+type Repository interface {
+	Create(ctx context.Context, ticket models.UploadTicket, ttl time.Duration) error
+	// Claim removes the ticket of the user and returns it. Tickets are
+	// claimed once, concurrent claims of a ticket get ErrTicketNotFound but
+	// one.
+	Claim(ctx context.Context, userID, id uuid.UUID) (*models.UploadTicket, error)
+}
+
+type repo struct {
+	redis *redis.Client
+}
+
+func NewRepo(redis *redis.Client) Repository {
+	return &repo{
+		redis,
+	}
+}
+
+// ticketKey includes the user, so claims by other users don't consume the
+// ticket.
+func ticketKey(userID, id uuid.UUID) string {
+	return "upload_ticket:" + userID.String() + ":" + id.String()
+}
+
+func (r *repo) Create(ctx context.Context, ticket models.UploadTicket, ttl time.Duration) error {
+	ticketBytes, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+
+	err = r.redis.Set(ctx, ticketKey(ticket.UserID, ticket.ID), ticketBytes, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set ticket in redis: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repo) Claim(ctx context.Context, userID, id uuid.UUID) (*models.UploadTicket, error) {
+	ticketBytes, err := r.redis.GetDel(ctx, ticketKey(userID, id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrTicketNotFound
+		}
+
+		return nil, fmt.Errorf("failed to claim ticket from redis: %w", err)
+	}
+
+	var ticket models.UploadTicket
+	if err := json.Unmarshal(ticketBytes, &ticket); err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+type MemoryRepo struct {
+	mu      sync.Mutex
+	Tickets map[uuid.UUID]models.UploadTicket
+}
+
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{
+		Tickets: map[uuid.UUID]models.UploadTicket{},
+	}
+}
+
+func (r *MemoryRepo) Create(_ context.Context, ticket models.UploadTicket, _ time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Tickets[ticket.ID] = ticket
+	return nil
+}
+
+func (r *MemoryRepo) Claim(_ context.Context, userID, id uuid.UUID) (*models.UploadTicket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ticket, ok := r.Tickets[id]
+	if !ok || ticket.UserID != userID {
+		return nil, ErrTicketNotFound
+	}
+
+	delete(r.Tickets, id)
+	return &ticket, nil
+}
@@ -35,6 +35,7 @@ func scanUser(row pgx.Row) (*models.User, error) {
 		&user.PasswordHash,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Tier,
 	)
 
 	return &user, err
@@ -95,6 +96,9 @@ func (r *MemoryRepo) Create(_ context.Context, user models.User) (*models.User,
 	user.ID = uuid.New()
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
+	if user.Tier == "" {
+		user.Tier = "free"
+	}
 
 	r.Users = append(r.Users, user)
 	return &user, nil
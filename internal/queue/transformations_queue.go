@@ -8,8 +8,10 @@ import (
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
 	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
 	"github.com/edulustosa/imago/internal/services/imgproc"
 	"github.com/edulustosa/imago/internal/storage"
 	"github.com/google/uuid"
@@ -34,6 +36,7 @@ type TransformationMessage struct {
 	ImageID         int                      `json:"imageId"`
 	UserID          uuid.UUID                `json:"userId"`
 	Transformations *imgproc.Transformations `json:"transformations"`
+	Accept          string                   `json:"accept,omitempty"`
 }
 
 type Status string
@@ -47,6 +50,7 @@ const (
 type TransformationStatus struct {
 	StatusID     uuid.UUID `json:"statusId"`
 	ImageID      int       `json:"imageId"`
+	VariantID    int       `json:"variantId,omitempty"`
 	Status       Status    `json:"status"`
 	ErrorMessage string    `json:"error"`
 }
@@ -92,8 +96,8 @@ type TransformationConsumer struct {
 	reader       *kafka.Reader
 	redis        *redis.Client
 	db           *pgxpool.Pool
-	s3Client     *s3.Client
-	bucketName   string
+	storage      *storage.Factory
+	limits       imgproc.TierLimits
 	processingWg sync.WaitGroup
 }
 
@@ -101,15 +105,15 @@ func NewTransformationConsumer(
 	reader *kafka.Reader,
 	redis *redis.Client,
 	db *pgxpool.Pool,
-	s3Client *s3.Client,
-	bucketName string,
+	storageFactory *storage.Factory,
+	limits imgproc.TierLimits,
 ) *TransformationConsumer {
 	return &TransformationConsumer{
-		reader:     reader,
-		redis:      redis,
-		db:         db,
-		s3Client:   s3Client,
-		bucketName: bucketName,
+		reader:  reader,
+		redis:   redis,
+		db:      db,
+		storage: storageFactory,
+		limits:  limits,
 	}
 }
 
@@ -191,12 +195,15 @@ func (c *TransformationConsumer) processMessage(ctx context.Context, msg kafka.M
 		Status:   StatusPending,
 	}
 
-	if err := c.transformImage(ctx, &transformationMessage); err != nil {
+	variant, err := c.transformImage(ctx, &transformationMessage)
+	if err != nil {
 		status.Status = StatusFailed
 		status.ErrorMessage = err.Error()
+	} else {
+		status.Status = StatusDone
+		status.VariantID = variant.ID
 	}
 
-	status.Status = StatusDone
 	if err := c.updateStatus(ctx, status); err != nil {
 		return fmt.Errorf("failed to update status: %w", err)
 	}
@@ -204,17 +211,32 @@ func (c *TransformationConsumer) processMessage(ctx context.Context, msg kafka.M
 	return nil
 }
 
-func (c *TransformationConsumer) transformImage(ctx context.Context, msg *TransformationMessage) error {
+func (c *TransformationConsumer) transformImage(
+	ctx context.Context,
+	msg *TransformationMessage,
+) (*models.ImageVariant, error) {
+	userRepository := user.NewRepo(c.db)
 	imgRepository := img.NewRepo(c.db)
-	imgStorage := storage.NewS3ImageStorage(c.s3Client, c.bucketName)
-
-	transformationService := imgproc.NewImageTransformation(imgRepository, imgStorage)
-	_, err := transformationService.Transform(ctx, msg.ImageID, msg.UserID, msg.Transformations)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	variantRepository := img.NewVariantRepo(c.db)
+	contentStore := storage.NewContentStore(
+		c.storage.ImageStorage(),
+		blob.NewRepo(c.db),
+	)
+
+	transformationService := imgproc.NewImageTransformation(
+		userRepository,
+		imgRepository,
+		variantRepository,
+		contentStore,
+		c.limits,
+	)
+	return transformationService.Transform(
+		ctx,
+		msg.ImageID,
+		msg.UserID,
+		msg.Transformations,
+		msg.Accept,
+	)
 }
 
 func (c *TransformationConsumer) updateStatus(
@@ -0,0 +1,254 @@
+package imgproc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"iter"
+
+	"github.com/anthonynsimon/bild/transform"
+)
+
+// Animation selects what to output for animated images. By default every
+// frame is transformed and the result is an animated gif. Other formats only
+// get the first frame since their encoders are static. Animated webp isn't
+// supported: the webp bindings only decode and encode still images.
+type Animation struct {
+	// Frame extracts a single frame, starting at 1 like pdf pages.
+	Frame *int `json:"frame" validate:"omitempty,gte=1"`
+	// Poster extracts the most detailed frame, a good static preview.
+	Poster bool `json:"poster" validate:"excluded_with=Frame"`
+}
+
+var ErrFrameOutOfRange = errors.New("frame out of range")
+
+// frames is a decoded image. The frames of animated gifs are composited one
+// at a time on a shared canvas as they are iterated, so memory doesn't grow
+// with the number of frames. Static images have a single frame.
+type frames struct {
+	images []image.Image
+	gif    *gif.GIF
+	// delays are in hundredths of a second.
+	delays    []int
+	loopCount int
+}
+
+// decodeFrames decodes every frame of an animated gif, applying the disposal
+// of each frame. Other images are decoded as a single frame with the EXIF
+// orientation applied. Svgs and the page of pdfs selected by t are
+// rasterized at the first size requested by t, within the limits.
+func decodeFrames(
+	ctx context.Context,
+	imgData []byte,
+	t *Transformations,
+	limits Limits,
+) (*frames, error) {
+	if g, err := gif.DecodeAll(bytes.NewReader(imgData)); err == nil && len(g.Image) > 1 {
+		return &frames{gif: g, delays: g.Delay, loopCount: g.LoopCount}, nil
+	}
+
+	width, height := targetSize(t)
+	img, _, err := image.Decode(bytes.NewReader(imgData))
+	switch {
+	case err == nil:
+	case isSVG(imgData):
+		img, err = rasterizeSVG(imgData, width, height, limits)
+	case isPDF(imgData):
+		img, err = renderPDFPage(ctx, imgData, t.Page, width, height, limits)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	return &frames{images: []image.Image{orient(img, orientation(imgData))}}, nil
+}
+
+func (f *frames) len() int {
+	if f.gif != nil {
+		return len(f.gif.Image)
+	}
+	return len(f.images)
+}
+
+// bounds returns the size of the frames, the canvas of animated gifs.
+func (f *frames) bounds() image.Rectangle {
+	if f.gif == nil {
+		return f.images[0].Bounds()
+	}
+
+	bounds := image.Rect(0, 0, f.gif.Config.Width, f.gif.Config.Height)
+	if bounds.Empty() {
+		bounds = f.gif.Image[0].Bounds()
+	}
+	return bounds
+}
+
+// all iterates over the fully composited frames. Gif frames are drawn on a
+// canvas reused by the next frame, so they must be copied to be kept.
+func (f *frames) all() iter.Seq2[int, image.Image] {
+	return func(yield func(int, image.Image) bool) {
+		if f.gif == nil {
+			for i, img := range f.images {
+				if !yield(i, img) {
+					return
+				}
+			}
+			return
+		}
+
+		bounds := f.bounds()
+		canvas := image.NewRGBA(bounds)
+		var previous *image.RGBA
+		for i, frame := range f.gif.Image {
+			disposal := byte(0)
+			if i < len(f.gif.Disposal) {
+				disposal = f.gif.Disposal[i]
+			}
+
+			if disposal == gif.DisposalPrevious {
+				if previous == nil {
+					previous = image.NewRGBA(bounds)
+				}
+				draw.Draw(previous, bounds, canvas, bounds.Min, draw.Src)
+			}
+
+			draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+			if !yield(i, canvas) {
+				return
+			}
+
+			switch disposal {
+			case gif.DisposalBackground:
+				draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+			case gif.DisposalPrevious:
+				canvas, previous = previous, canvas
+			}
+		}
+	}
+}
+
+// selectFrame keeps the frame chosen by the animation options.
+func (f *frames) selectFrame(a *Animation) error {
+	index := -1
+	switch {
+	case a.Frame != nil:
+		index = *a.Frame - 1
+		if index < 0 || index >= f.len() {
+			return fmt.Errorf("%w: the image has %d frames", ErrFrameOutOfRange, f.len())
+		}
+	case a.Poster:
+		index = f.posterFrame()
+	}
+
+	if index >= 0 {
+		f.keep(index)
+	}
+
+	return nil
+}
+
+// keep drops every frame but the one at index.
+func (f *frames) keep(index int) {
+	if f.gif == nil {
+		f.images = f.images[index : index+1]
+		return
+	}
+
+	for i, img := range f.all() {
+		if i == index {
+			kept := image.NewRGBA(img.Bounds())
+			draw.Draw(kept, kept.Bounds(), img, img.Bounds().Min, draw.Src)
+			f.images = []image.Image{kept}
+			break
+		}
+	}
+
+	f.gif = nil
+	f.delays = nil
+}
+
+func (f *frames) animated() bool {
+	return f.len() > 1
+}
+
+// posterFrame returns the index of the frame with the highest edge energy.
+func (f *frames) posterFrame() int {
+	best, bestEnergy := 0, -1.0
+	for i, img := range f.all() {
+		bounds := img.Bounds()
+		scale := min(1, float64(energySampleSize)/float64(max(bounds.Dx(), bounds.Dy())))
+		sample := transform.Resize(
+			img,
+			max(1, int(float64(bounds.Dx())*scale)),
+			max(1, int(float64(bounds.Dy())*scale)),
+			transform.Box,
+		)
+
+		integral := energyIntegral(sample)
+		if energy := integral[len(integral)-1][len(integral[0])-1]; energy > bestEnergy {
+			best, bestEnergy = i, energy
+		}
+	}
+
+	return best
+}
+
+// gifEncoder builds an animated gif, quantizing each frame as it is added so
+// only the paletted frames are kept until encoding.
+type gifEncoder struct {
+	g       *gif.GIF
+	palette color.Palette
+	drawer  draw.Drawer
+	delays  []int
+}
+
+func newGifEncoder(f *frames, opts *Output) *gifEncoder {
+	numColors := 256
+	if opts.Colors != 0 {
+		numColors = opts.Colors
+	}
+
+	var drawer draw.Drawer = draw.FloydSteinberg
+	if opts.Dither != nil && !*opts.Dither {
+		drawer = draw.Src
+	}
+
+	return &gifEncoder{
+		g:       &gif.GIF{LoopCount: f.loopCount},
+		palette: palette.Plan9[:numColors],
+		drawer:  drawer,
+		delays:  f.delays,
+	}
+}
+
+// add appends a frame. Frames are full canvases, so each one is disposed
+// before drawing the next.
+func (e *gifEncoder) add(img image.Image) {
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), e.palette)
+	e.drawer.Draw(paletted, paletted.Bounds(), img, bounds.Min)
+
+	delay := 0
+	if i := len(e.g.Image); i < len(e.delays) {
+		delay = e.delays[i]
+	}
+
+	e.g.Image = append(e.g.Image, paletted)
+	e.g.Delay = append(e.g.Delay, delay)
+	e.g.Disposal = append(e.g.Disposal, gif.DisposalBackground)
+}
+
+func (e *gifEncoder) encode(w io.Writer) error {
+	if err := gif.EncodeAll(w, e.g); err != nil {
+		return fmt.Errorf("failed to encode gif file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+)
+
+func TestAnimation(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := user.NewMemoryRepo()
+	imgRepo := img.NewMemoryRepo()
+	contentStore := storage.NewContentStore(storage.NewFSImageStorage("test_data", ""), blob.NewMemoryRepo())
+
+	usr, _ := userRepo.Create(ctx, models.User{
+		Username:     "test",
+		PasswordHash: "test",
+	})
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./test_data/blobs")
+	})
+
+	upload := imgproc.NewUpload(userRepo, imgRepo, contentStore, imgproc.TierLimits{})
+	_, err := upload.Do(ctx, usr.ID, animatedGif(t), &imgproc.ImageMetadata{
+		Filename: "animated.gif",
+		Format:   "gif",
+	})
+	if err != nil {
+		t.Fatalf("could not upload image: %v", err)
+	}
+
+	sut := imgproc.NewDelivery(userRepo, imgRepo, contentStore, imgproc.TierLimits{}, false)
+	deliver := func(t *testing.T, tr *imgproc.Transformations) []byte {
+		t.Helper()
+
+		imgData, _, err := sut.Do(ctx, usr.ID, "animated.gif", tr, "")
+		if err != nil {
+			t.Fatalf("could not deliver image: %v", err)
+		}
+
+		return imgData
+	}
+
+	t.Run("transforms every frame", func(t *testing.T) {
+		imgData := deliver(t, &imgproc.Transformations{
+			Resize: imgproc.Resize{Width: 20},
+			Format: "gif",
+		})
+
+		g, err := gif.DecodeAll(bytes.NewReader(imgData))
+		if err != nil {
+			t.Fatalf("failed to decode gif: %v", err)
+		}
+
+		if len(g.Image) != 3 {
+			t.Fatalf("expected 3 frames, got %d", len(g.Image))
+		}
+
+		for i, frame := range g.Image {
+			if frame.Bounds().Dx() != 20 || frame.Bounds().Dy() != 20 {
+				t.Errorf("expected frame %d to be 20x20, got %v", i, frame.Bounds().Size())
+			}
+		}
+
+		if g.Delay[1] != 20 {
+			t.Errorf("expected delays to be kept, got %v", g.Delay)
+		}
+
+		// The second frame only covers the top half, the bottom half still
+		// shows the first frame.
+		if !isColor(g.Image[1], image.Pt(10, 15), 0xff, 0, 0) {
+			t.Errorf("expected the first frame below the second, got %v", g.Image[1].At(10, 15))
+		}
+	})
+
+	t.Run("extracts a frame", func(t *testing.T) {
+		frame := 2
+		got, err := png.Decode(bytes.NewReader(deliver(t, &imgproc.Transformations{
+			Format:    "png",
+			Animation: imgproc.Animation{Frame: &frame},
+		})))
+		if err != nil {
+			t.Fatalf("failed to decode png: %v", err)
+		}
+
+		if !isColor(got, image.Pt(5, 5), 0, 0, 0xff) || !isColor(got, image.Pt(5, 35), 0xff, 0, 0) {
+			t.Errorf("expected the second frame, got %v and %v", got.At(5, 5), got.At(5, 35))
+		}
+	})
+
+	t.Run("extracts the poster", func(t *testing.T) {
+		imgData := deliver(t, &imgproc.Transformations{
+			Format:    "gif",
+			Animation: imgproc.Animation{Poster: true},
+		})
+
+		g, err := gif.DecodeAll(bytes.NewReader(imgData))
+		if err != nil {
+			t.Fatalf("failed to decode gif: %v", err)
+		}
+
+		if len(g.Image) != 1 {
+			t.Fatalf("expected a single frame, got %d", len(g.Image))
+		}
+
+		// The last frame is a checkerboard, the most detailed one.
+		if isColor(g.Image[0], image.Pt(0, 0), 0, 0xff, 0) == isColor(g.Image[0], image.Pt(1, 0), 0, 0xff, 0) {
+			t.Error("expected the checkerboard frame")
+		}
+	})
+
+	t.Run("crops every frame at the same place", func(t *testing.T) {
+		// The detail moves from the left half to the right half.
+		half := func(left bool) *image.Paletted {
+			frame := image.NewPaletted(image.Rect(0, 0, 40, 20), palette.Plan9)
+			for y := 0; y < 20; y++ {
+				for x := 0; x < 40; x++ {
+					frame.Set(x, y, color.Black)
+					if (x < 20) == left && (x+y)%2 == 0 {
+						frame.Set(x, y, color.White)
+					}
+				}
+			}
+
+			return frame
+		}
+
+		buf := new(bytes.Buffer)
+		err := gif.EncodeAll(buf, &gif.GIF{
+			Image: []*image.Paletted{half(true), half(false)},
+			Delay: []int{10, 10},
+		})
+		if err != nil {
+			t.Fatalf("failed to encode gif: %v", err)
+		}
+
+		_, err = upload.Do(ctx, usr.ID, buf.Bytes(), &imgproc.ImageMetadata{
+			Filename: "moving.gif",
+			Format:   "gif",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		imgData, _, err := sut.Do(ctx, usr.ID, "moving.gif", &imgproc.Transformations{
+			Format: "gif",
+			Crop:   imgproc.Crop{Width: 20, Height: 20, Gravity: imgproc.GravityAuto},
+		}, "")
+		if err != nil {
+			t.Fatalf("could not deliver image: %v", err)
+		}
+
+		g, err := gif.DecodeAll(bytes.NewReader(imgData))
+		if err != nil {
+			t.Fatalf("failed to decode gif: %v", err)
+		}
+
+		if len(g.Image) != 2 {
+			t.Fatalf("expected 2 frames, got %d", len(g.Image))
+		}
+
+		// The window of the first frame, on the left, is kept.
+		if !isColor(g.Image[0], image.Pt(0, 0), 0xff, 0xff, 0xff) {
+			t.Errorf("expected the detail in the first frame, got %v", g.Image[0].At(0, 0))
+		}
+
+		if !isColor(g.Image[1], image.Pt(0, 0), 0, 0, 0) || !isColor(g.Image[1], image.Pt(1, 0), 0, 0, 0) {
+			t.Errorf("expected the second frame cropped like the first, got %v", g.Image[1].At(0, 0))
+		}
+	})
+
+	t.Run("restores the previous frame", func(t *testing.T) {
+		fill := func(r image.Rectangle, c color.Color) *image.Paletted {
+			frame := image.NewPaletted(r, palette.Plan9)
+			draw.Draw(frame, r, image.NewUniform(c), image.Point{}, draw.Src)
+			return frame
+		}
+
+		// The blue top half is undone before the green bottom quarter.
+		buf := new(bytes.Buffer)
+		err := gif.EncodeAll(buf, &gif.GIF{
+			Image: []*image.Paletted{
+				fill(image.Rect(0, 0, 40, 40), color.RGBA{0xff, 0, 0, 0xff}),
+				fill(image.Rect(0, 0, 40, 20), color.RGBA{0, 0, 0xff, 0xff}),
+				fill(image.Rect(0, 30, 40, 40), color.RGBA{0, 0xff, 0, 0xff}),
+			},
+			Delay:    []int{10, 10, 10},
+			Disposal: []byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalNone},
+		})
+		if err != nil {
+			t.Fatalf("failed to encode gif: %v", err)
+		}
+
+		_, err = upload.Do(ctx, usr.ID, buf.Bytes(), &imgproc.ImageMetadata{
+			Filename: "disposal.gif",
+			Format:   "gif",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		imgData, _, err := sut.Do(ctx, usr.ID, "disposal.gif", &imgproc.Transformations{Format: "gif"}, "")
+		if err != nil {
+			t.Fatalf("could not deliver image: %v", err)
+		}
+
+		g, err := gif.DecodeAll(bytes.NewReader(imgData))
+		if err != nil {
+			t.Fatalf("failed to decode gif: %v", err)
+		}
+
+		if !isColor(g.Image[1], image.Pt(5, 5), 0, 0, 0xff) {
+			t.Errorf("expected the second frame to be blue on top, got %v", g.Image[1].At(5, 5))
+		}
+		if !isColor(g.Image[2], image.Pt(5, 5), 0xff, 0, 0) || !isColor(g.Image[2], image.Pt(5, 35), 0, 0xff, 0) {
+			t.Errorf("expected the first frame under the third, got %v and %v", g.Image[2].At(5, 5), g.Image[2].At(5, 35))
+		}
+	})
+
+	t.Run("frame out of range", func(t *testing.T) {
+		frame := 4
+		_, _, err := sut.Do(ctx, usr.ID, "animated.gif", &imgproc.Transformations{
+			Format:    "png",
+			Animation: imgproc.Animation{Frame: &frame},
+		}, "")
+		if !errors.Is(err, imgproc.ErrFrameOutOfRange) {
+			t.Errorf("expected ErrFrameOutOfRange, got %v", err)
+		}
+	})
+}
+
+// animatedGif returns a 40x40 gif with three frames: a red one, a blue one
+// covering only the top half, and a green and black checkerboard.
+func animatedGif(t *testing.T) []byte {
+	t.Helper()
+
+	fill := func(r image.Rectangle, c func(x, y int) color.Color) *image.Paletted {
+		frame := image.NewPaletted(r, palette.Plan9)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				frame.Set(x, y, c(x, y))
+			}
+		}
+
+		return frame
+	}
+
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	green := color.RGBA{0, 0xff, 0, 0xff}
+
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			fill(image.Rect(0, 0, 40, 40), func(_, _ int) color.Color { return red }),
+			fill(image.Rect(0, 0, 40, 20), func(_, _ int) color.Color { return blue }),
+			fill(image.Rect(0, 0, 40, 40), func(x, y int) color.Color {
+				if (x+y)%2 == 0 {
+					return green
+				}
+				return color.Black
+			}),
+		},
+		Delay:    []int{10, 20, 30},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalNone, gif.DisposalNone},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, g); err != nil {
+		t.Fatalf("failed to encode gif: %v", err)
+	}
+
+	return buf.Bytes()
+}
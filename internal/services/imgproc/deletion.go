@@ -0,0 +1,62 @@
+package imgproc
+
+import (
+	"context"
+
+	"github.com/edulustosa/imago/internal/database"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/google/uuid"
+)
+
+type Deletion struct {
+	transactor        database.Transactor
+	imageRepository   img.Repository
+	variantRepository img.VariantRepository
+	contentStore      *storage.ContentStore
+}
+
+func NewDeletion(
+	transactor database.Transactor,
+	imageRepository img.Repository,
+	variantRepository img.VariantRepository,
+	contentStore *storage.ContentStore,
+) *Deletion {
+	return &Deletion{
+		transactor,
+		imageRepository,
+		variantRepository,
+		contentStore,
+	}
+}
+
+// Do deletes the image and its variants. Their content is only removed from
+// the storage once no other image or variant references it. The references
+// are released in the transaction deleting the rows, so a failure keeps
+// both and the deletion can be retried. Storage deletes can't be rolled
+// back, they only happen as the last reference of an object goes.
+func (d *Deletion) Do(ctx context.Context, imageID int, userID uuid.UUID) error {
+	imgInfo, err := d.imageRepository.FindByID(ctx, imageID, userID)
+	if err != nil {
+		return ErrImageNotFound
+	}
+
+	return d.transactor.InTx(ctx, func(ctx context.Context) error {
+		variants, err := d.variantRepository.DeleteManyByImageID(ctx, imgInfo.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := d.imageRepository.Delete(ctx, imgInfo.ID, userID); err != nil {
+			return err
+		}
+
+		for _, variant := range variants {
+			if err := d.contentStore.Release(ctx, variant.StorageKey); err != nil {
+				return err
+			}
+		}
+
+		return d.contentStore.Release(ctx, imgInfo.StorageKey)
+	})
+}
@@ -0,0 +1,128 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/database"
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+)
+
+func TestDeletion(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := user.NewMemoryRepo()
+	imgRepo := img.NewMemoryRepo()
+	variantRepo := img.NewMemoryVariantRepo()
+	blobRepo := blob.NewMemoryRepo()
+	contentStore := storage.NewContentStore(storage.NewFSImageStorage("test_data", ""), blobRepo)
+
+	usr, _ := userRepo.Create(ctx, models.User{
+		Username:     "test",
+		PasswordHash: "test",
+	})
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./test_data/blobs")
+	})
+
+	imgData := rotatedJpeg(t)
+	upload := imgproc.NewUpload(userRepo, imgRepo, contentStore, imgproc.TierLimits{})
+	first, err := upload.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+		Filename: "first.jpg",
+		Format:   "jpeg",
+	})
+	if err != nil {
+		t.Fatalf("could not upload image: %v", err)
+	}
+
+	second, err := upload.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+		Filename: "second.jpg",
+		Format:   "jpeg",
+	})
+	if err != nil {
+		t.Fatalf("could not upload image: %v", err)
+	}
+
+	transformation := imgproc.NewImageTransformation(userRepo, imgRepo, variantRepo, contentStore, imgproc.TierLimits{})
+	variant, err := transformation.Transform(ctx, first.ID, usr.ID, &imgproc.Transformations{
+		Format: "png",
+	}, "")
+	if err != nil {
+		t.Fatalf("could not transform image: %v", err)
+	}
+
+	sut := imgproc.NewDeletion(database.NoTx{}, imgRepo, variantRepo, contentStore)
+	exists := func(key string) bool {
+		_, err := os.Stat(filepath.Join("test_data", key))
+		return err == nil
+	}
+
+	t.Run("keeps shared content", func(t *testing.T) {
+		if err := sut.Do(ctx, first.ID, usr.ID); err != nil {
+			t.Fatalf("could not delete image: %v", err)
+		}
+
+		if _, err := imgRepo.FindByID(ctx, first.ID, usr.ID); err == nil {
+			t.Error("expected the image to be deleted")
+		}
+
+		if !exists(second.StorageKey) {
+			t.Error("expected the content shared with the second image to be kept")
+		}
+
+		if exists(variant.StorageKey) {
+			t.Error("expected the variant content to be deleted")
+		}
+
+		variants, _ := variantRepo.FindManyByImageID(ctx, first.ID, usr.ID)
+		if len(variants) != 0 {
+			t.Errorf("expected no variants, got %d", len(variants))
+		}
+	})
+
+	t.Run("deletes unreferenced content", func(t *testing.T) {
+		if err := sut.Do(ctx, second.ID, usr.ID); err != nil {
+			t.Fatalf("could not delete image: %v", err)
+		}
+
+		if exists(second.StorageKey) {
+			t.Error("expected the content to be deleted")
+		}
+
+		if len(blobRepo.Refs) != 0 {
+			t.Errorf("expected no references left, got %v", blobRepo.Refs)
+		}
+	})
+
+	t.Run("keeps untracked content", func(t *testing.T) {
+		fsStorage := storage.NewFSImageStorage("test_data", "")
+		key := storage.ContentKey([]byte("untracked"))
+		if _, err := fsStorage.Upload(ctx, bytes.NewReader([]byte("untracked")), key); err != nil {
+			t.Fatalf("could not store object: %v", err)
+		}
+
+		if err := contentStore.Release(ctx, key); !errors.Is(err, blob.ErrBlobNotFound) {
+			t.Errorf("expected ErrBlobNotFound, got %v", err)
+		}
+
+		if !exists(key) {
+			t.Error("expected the untracked object to be kept")
+		}
+	})
+
+	t.Run("image not found", func(t *testing.T) {
+		if err := sut.Do(ctx, second.ID, usr.ID); err != imgproc.ErrImageNotFound {
+			t.Errorf("expected ErrImageNotFound, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package imgproc
+
+import (
+	"context"
+
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Delivery serves transformed images without authentication. With
+// publicOnly, used for private buckets, only public images are delivered
+// and private ones are reported as not found, watermark overlays included.
+type Delivery struct {
+	userRepository  user.Repository
+	imageRepository img.Repository
+	imageStorage    storage.Downloader
+	limits          TierLimits
+	publicOnly      bool
+}
+
+func NewDelivery(
+	userRepository user.Repository,
+	imageRepository img.Repository,
+	imageStorage storage.Downloader,
+	limits TierLimits,
+	publicOnly bool,
+) *Delivery {
+	return &Delivery{
+		userRepository,
+		imageRepository,
+		imageStorage,
+		limits,
+		publicOnly,
+	}
+}
+
+// rasterFormats are the output formats used for originals that can only be
+// decoded, such as vectors and documents.
+var rasterFormats = map[string]string{
+	"heic": "jpeg",
+	"heif": "jpeg",
+	"svg":  "png",
+	"pdf":  "png",
+}
+
+// Do transforms the image synchronously and returns the encoded bytes
+// together with the output format. The original image is left untouched.
+// accept is the Accept header used to negotiate FormatAuto.
+func (d *Delivery) Do(
+	ctx context.Context,
+	userID uuid.UUID,
+	filename string,
+	t *Transformations,
+	accept string,
+) ([]byte, string, error) {
+	usr, err := d.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return nil, "", ErrImageNotFound
+	}
+
+	imgInfo, err := d.imageRepository.FindByFilename(ctx, filename, userID)
+	if err != nil || (d.publicOnly && !imgInfo.Public) {
+		return nil, "", ErrImageNotFound
+	}
+
+	if t.Format == "" {
+		t.Format = imgInfo.Format
+		if format, ok := rasterFormats[t.Format]; ok {
+			t.Format = format
+		}
+	}
+
+	if err := t.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	err = loadWatermarks(ctx, d.imageRepository, d.imageStorage, userID, t, d.publicOnly)
+	if err != nil {
+		return nil, "", err
+	}
+
+	imgFile, err := d.imageStorage.DownloadImage(ctx, imgInfo.StorageKey)
+	if err != nil {
+		return nil, "", err
+	}
+	defer imgFile.Close()
+
+	imgData, err := processImage(ctx, imgFile, t, accept, d.limits.For(usr.Tier))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return imgData, t.Format, nil
+}
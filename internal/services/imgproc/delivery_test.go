@@ -0,0 +1,74 @@
+package imgproc_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+)
+
+func TestDelivery(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := user.NewMemoryRepo()
+	imgRepo := img.NewMemoryRepo()
+	contentStore := storage.NewContentStore(storage.NewFSImageStorage("test_data", ""), blob.NewMemoryRepo())
+
+	usr, _ := userRepo.Create(ctx, models.User{
+		Username:     "test",
+		PasswordHash: "test",
+	})
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./test_data/blobs")
+		_ = os.RemoveAll("./test_data/public")
+	})
+
+	upload := imgproc.NewUpload(userRepo, imgRepo, contentStore, imgproc.TierLimits{})
+	for _, metadata := range []*imgproc.ImageMetadata{
+		{Filename: "private.jpg", Format: "jpeg"},
+		{Filename: "public.jpg", Format: "jpeg", Public: true},
+	} {
+		if _, err := upload.Do(ctx, usr.ID, rotatedJpeg(t), metadata); err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+	}
+
+	private, _ := imgRepo.FindByFilename(ctx, "private.jpg", usr.ID)
+
+	t.Run("delivers every image", func(t *testing.T) {
+		sut := imgproc.NewDelivery(userRepo, imgRepo, contentStore, imgproc.TierLimits{}, false)
+		_, _, err := sut.Do(ctx, usr.ID, "private.jpg", &imgproc.Transformations{}, "")
+		if err != nil {
+			t.Errorf("could not deliver image: %v", err)
+		}
+	})
+
+	t.Run("public only", func(t *testing.T) {
+		sut := imgproc.NewDelivery(userRepo, imgRepo, contentStore, imgproc.TierLimits{}, true)
+		_, _, err := sut.Do(ctx, usr.ID, "public.jpg", &imgproc.Transformations{}, "")
+		if err != nil {
+			t.Errorf("could not deliver public image: %v", err)
+		}
+
+		_, _, err = sut.Do(ctx, usr.ID, "private.jpg", &imgproc.Transformations{}, "")
+		if !errors.Is(err, imgproc.ErrImageNotFound) {
+			t.Errorf("expected ErrImageNotFound, got %v", err)
+		}
+
+		// Private images can't be leaked as watermarks either.
+		_, _, err = sut.Do(ctx, usr.ID, "public.jpg", &imgproc.Transformations{
+			Watermark: &imgproc.Watermark{ImageID: private.ID},
+		}, "")
+		if !errors.Is(err, imgproc.ErrWatermarkNotFound) {
+			t.Errorf("expected ErrWatermarkNotFound, got %v", err)
+		}
+	})
+}
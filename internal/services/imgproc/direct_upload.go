@@ -0,0 +1,176 @@
+package imgproc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/upload"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	// uploadURLExpiry is how long presigned upload urls are valid.
+	uploadURLExpiry = 15 * time.Minute
+	// uploadTicketTTL leaves time to complete uploads started right before
+	// their url expired.
+	uploadTicketTTL = time.Hour
+)
+
+var (
+	ErrUploadNotFound = errors.New("the file of the ticket was not uploaded")
+	ErrUploadMismatch = errors.New("the uploaded file does not match the ticket size")
+	ErrFileTooLarge   = errors.New("file exceeds the maximum upload size")
+)
+
+// DirectUpload lets clients send files straight to the storage through a
+// presigned url, so they don't go through the API. Start returns the url and
+// a ticket, Complete validates the uploaded file like Upload and creates the
+// image. Uploaded files are staged under "uploads/" of the image storage,
+// outside of the content store. Files of tickets never completed are left
+// there, they are expected to be expired by a lifecycle rule of the bucket.
+type DirectUpload struct {
+	ticketRepository upload.Repository
+	staging          storage.ImageStorage
+	presigner        storage.Presigner
+	upload           *Upload
+	documentUpload   *DocumentUpload
+	maxSize          int64
+}
+
+func NewDirectUpload(
+	userRepository user.Repository,
+	imageRepository img.Repository,
+	ticketRepository upload.Repository,
+	imageStorage storage.ImageStorage,
+	contentStore *storage.ContentStore,
+	presigner storage.Presigner,
+	limits TierLimits,
+	maxSize int64,
+) *DirectUpload {
+	return &DirectUpload{
+		ticketRepository,
+		imageStorage,
+		presigner,
+		NewUpload(userRepository, imageRepository, contentStore, limits),
+		NewDocumentUpload(userRepository, imageRepository, contentStore, limits),
+		maxSize,
+	}
+}
+
+// Start creates a ticket for an upload of size bytes, holding the presigned
+// url the client must PUT the file to.
+func (d *DirectUpload) Start(
+	ctx context.Context,
+	userID uuid.UUID,
+	size int64,
+	metadata *ImageMetadata,
+) (*models.UploadTicket, error) {
+	if _, err := d.upload.userRepository.FindByID(ctx, userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if _, ok := ContentTypes[metadata.Format]; !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	if d.maxSize > 0 && size > d.maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	ticket := models.UploadTicket{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Filename:  metadata.Filename,
+		Format:    metadata.Format,
+		Alt:       metadata.Alt,
+		Dedupe:    metadata.Dedupe,
+		Public:    metadata.Public,
+		Size:      size,
+		ExpiresAt: time.Now().Add(uploadURLExpiry),
+	}
+	ticket.StorageKey = fmt.Sprintf("uploads/%s/%s", userID, ticket.ID)
+
+	url, err := d.presigner.PresignUpload(ctx, ticket.StorageKey, size, uploadURLExpiry)
+	if err != nil {
+		return nil, err
+	}
+	ticket.UploadURL = url
+
+	if err := d.ticketRepository.Create(ctx, ticket, uploadTicketTTL); err != nil {
+		return nil, err
+	}
+
+	return &ticket, nil
+}
+
+// Complete validates the file uploaded for the ticket and creates its image.
+// The ticket is claimed before anything else so it is used once, even by
+// concurrent calls. It is put back when the uploaded file can't be read,
+// e.g. when completing before the upload is done, so the call can be
+// retried. Once the file is read the ticket is used and the file is
+// discarded whatever the outcome of the validation. Unknown tickets and
+// tickets of other users fail with upload.ErrTicketNotFound.
+func (d *DirectUpload) Complete(
+	ctx context.Context,
+	userID uuid.UUID,
+	ticketID uuid.UUID,
+) (*models.Image, error) {
+	ticket, err := d.ticketRepository.Claim(ctx, userID, ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := d.staging.DownloadImage(ctx, ticket.StorageKey)
+	if err != nil {
+		d.restore(ctx, ticket)
+		return nil, ErrUploadNotFound
+	}
+	defer object.Close()
+
+	// The presigned url only accepts the declared size, reading a byte more
+	// catches storages that don't enforce it.
+	spool, err := storage.NewSpool(io.LimitReader(object, ticket.Size+1))
+	if err != nil {
+		d.restore(ctx, ticket)
+		return nil, err
+	}
+	defer spool.Close()
+	defer d.discard(ctx, ticket)
+
+	if spool.Size() != ticket.Size {
+		return nil, ErrUploadMismatch
+	}
+
+	metadata := &ImageMetadata{
+		Filename: ticket.Filename,
+		Format:   ticket.Format,
+		Alt:      ticket.Alt,
+		Dedupe:   ticket.Dedupe,
+		Public:   ticket.Public,
+	}
+
+	if ticket.Format == "pdf" {
+		return d.documentUpload.DoSpool(ctx, userID, spool, metadata)
+	}
+
+	return d.upload.DoSpool(ctx, userID, spool, metadata)
+}
+
+// restore puts a claimed ticket back until it would have expired.
+func (d *DirectUpload) restore(ctx context.Context, ticket *models.UploadTicket) {
+	ttl := time.Until(ticket.ExpiresAt.Add(uploadTicketTTL - uploadURLExpiry))
+	if ttl > 0 {
+		_ = d.ticketRepository.Create(ctx, *ticket, ttl)
+	}
+}
+
+func (d *DirectUpload) discard(ctx context.Context, ticket *models.UploadTicket) {
+	_ = d.staging.Delete(ctx, ticket.StorageKey)
+}
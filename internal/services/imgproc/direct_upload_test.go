@@ -0,0 +1,218 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/upload"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/google/uuid"
+)
+
+type fakePresigner struct{}
+
+func (fakePresigner) PresignUpload(_ context.Context, path string, _ int64, _ time.Duration) (string, error) {
+	return "https://storage.test/" + path, nil
+}
+
+func (fakePresigner) PresignDownload(_ context.Context, path string, _ time.Duration) (string, error) {
+	return "https://storage.test/" + path, nil
+}
+
+func TestDirectUpload(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := user.NewMemoryRepo()
+	imgRepo := img.NewMemoryRepo()
+	ticketRepo := upload.NewMemoryRepo()
+	fsStorage := storage.NewFSImageStorage("test_data", "")
+	contentStore := storage.NewContentStore(fsStorage, blob.NewMemoryRepo())
+
+	usr, _ := userRepo.Create(ctx, models.User{
+		Username:     "test",
+		PasswordHash: "test",
+	})
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./test_data/blobs")
+		_ = os.RemoveAll("./test_data/uploads")
+	})
+
+	imgData, err := os.ReadFile("./test_data/flowers.jpg")
+	if err != nil {
+		t.Fatalf("could not read image file: %v", err)
+	}
+
+	sut := imgproc.NewDirectUpload(
+		userRepo,
+		imgRepo,
+		ticketRepo,
+		fsStorage,
+		contentStore,
+		fakePresigner{},
+		imgproc.TierLimits{},
+		int64(len(imgData)),
+	)
+
+	start := func(t *testing.T, filename string, size int64) *models.UploadTicket {
+		t.Helper()
+
+		ticket, err := sut.Start(ctx, usr.ID, size, &imgproc.ImageMetadata{
+			Filename: filename,
+			Format:   "jpg",
+		})
+		if err != nil {
+			t.Fatalf("could not start upload: %v", err)
+		}
+
+		return ticket
+	}
+
+	t.Run("upload", func(t *testing.T) {
+		ticket := start(t, "flowers.jpg", int64(len(imgData)))
+		if ticket.UploadURL != "https://storage.test/"+ticket.StorageKey {
+			t.Errorf("expected a presigned url for %s, got %s", ticket.StorageKey, ticket.UploadURL)
+		}
+
+		// The client uploads the file straight to the storage.
+		if _, err := fsStorage.Upload(ctx, bytes.NewReader(imgData), ticket.StorageKey); err != nil {
+			t.Fatalf("could not upload file: %v", err)
+		}
+
+		imgInfo, err := sut.Complete(ctx, usr.ID, ticket.ID)
+		if err != nil {
+			t.Fatalf("could not complete upload: %v", err)
+		}
+
+		if imgInfo.StorageKey != storage.ContentKey(imgData) || imgInfo.Width != 6000 {
+			t.Errorf("expected the uploaded image, got %+v", imgInfo)
+		}
+
+		if _, err := os.Stat("./test_data/" + ticket.StorageKey); !os.IsNotExist(err) {
+			t.Error("expected the uploaded file to be discarded")
+		}
+
+		_, err = sut.Complete(ctx, usr.ID, ticket.ID)
+		if !errors.Is(err, upload.ErrTicketNotFound) {
+			t.Errorf("expected tickets to be used once, got %v", err)
+		}
+	})
+
+	t.Run("completes a ticket once", func(t *testing.T) {
+		ticket := start(t, "concurrent.jpg", int64(len(imgData)))
+		if _, err := fsStorage.Upload(ctx, bytes.NewReader(imgData), ticket.StorageKey); err != nil {
+			t.Fatalf("could not upload file: %v", err)
+		}
+
+		var (
+			wg        sync.WaitGroup
+			completed atomic.Int32
+		)
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := sut.Complete(ctx, usr.ID, ticket.ID); err == nil {
+					completed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if completed.Load() != 1 {
+			t.Errorf("expected the ticket to be completed once, got %d", completed.Load())
+		}
+	})
+
+	t.Run("file too large", func(t *testing.T) {
+		_, err := sut.Start(ctx, usr.ID, int64(len(imgData))+1, &imgproc.ImageMetadata{
+			Filename: "large.jpg",
+			Format:   "jpg",
+		})
+		if !errors.Is(err, imgproc.ErrFileTooLarge) {
+			t.Errorf("expected ErrFileTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		_, err := sut.Start(ctx, usr.ID, 10, &imgproc.ImageMetadata{
+			Filename: "notes.txt",
+			Format:   "txt",
+		})
+		if !errors.Is(err, imgproc.ErrUnsupportedFormat) {
+			t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+		}
+	})
+
+	t.Run("file not uploaded", func(t *testing.T) {
+		ticket := start(t, "missing.jpg", int64(len(imgData)))
+
+		_, err := sut.Complete(ctx, usr.ID, ticket.ID)
+		if !errors.Is(err, imgproc.ErrUploadNotFound) {
+			t.Errorf("expected ErrUploadNotFound, got %v", err)
+		}
+
+		// The ticket is kept, so completing once uploaded works.
+		if _, err := fsStorage.Upload(ctx, bytes.NewReader(imgData), ticket.StorageKey); err != nil {
+			t.Fatalf("could not upload file: %v", err)
+		}
+
+		if _, err := sut.Complete(ctx, usr.ID, ticket.ID); err != nil {
+			t.Errorf("expected the ticket to be kept, got %v", err)
+		}
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		ticket := start(t, "short.jpg", 10)
+		if _, err := fsStorage.Upload(ctx, bytes.NewReader(imgData[:20]), ticket.StorageKey); err != nil {
+			t.Fatalf("could not upload file: %v", err)
+		}
+
+		_, err := sut.Complete(ctx, usr.ID, ticket.ID)
+		if !errors.Is(err, imgproc.ErrUploadMismatch) {
+			t.Errorf("expected ErrUploadMismatch, got %v", err)
+		}
+	})
+
+	t.Run("ticket of another user", func(t *testing.T) {
+		ticket := start(t, "other.jpg", 10)
+
+		_, err := sut.Complete(ctx, uuid.New(), ticket.ID)
+		if !errors.Is(err, upload.ErrTicketNotFound) {
+			t.Errorf("expected ErrTicketNotFound, got %v", err)
+		}
+
+		// The ticket is still there for its user.
+		_, err = sut.Complete(ctx, usr.ID, ticket.ID)
+		if !errors.Is(err, imgproc.ErrUploadNotFound) {
+			t.Errorf("expected ErrUploadNotFound, got %v", err)
+		}
+	})
+
+	t.Run("ticket used by a validation", func(t *testing.T) {
+		ticket := start(t, "used.jpg", 10)
+		if _, err := fsStorage.Upload(ctx, bytes.NewReader(imgData[:20]), ticket.StorageKey); err != nil {
+			t.Fatalf("could not upload file: %v", err)
+		}
+
+		if _, err := sut.Complete(ctx, usr.ID, ticket.ID); !errors.Is(err, imgproc.ErrUploadMismatch) {
+			t.Fatalf("expected ErrUploadMismatch, got %v", err)
+		}
+
+		_, err := sut.Complete(ctx, usr.ID, ticket.ID)
+		if !errors.Is(err, upload.ErrTicketNotFound) {
+			t.Errorf("expected ErrTicketNotFound, got %v", err)
+		}
+	})
+}
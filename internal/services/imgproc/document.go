@@ -0,0 +1,266 @@
+package imgproc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/google/uuid"
+)
+
+// pdfDPI is the resolution pages are rendered at when no size is requested.
+const pdfDPI = 150
+
+// pdfTimeout bounds the time poppler may spend on a page, so a crafted
+// document can't hold a request or a worker forever.
+const pdfTimeout = 30 * time.Second
+
+var (
+	ErrInvalidDocument = errors.New("failed to render document: invalid pdf")
+	ErrPageOutOfRange  = errors.New("page out of range")
+)
+
+// DocumentUpload stores pdf documents next to the images. The document is
+// kept as it is and its pages are rendered on transform, see
+// Transformations.Page. Rendering relies on pdftoppm and pdfinfo from
+// poppler-utils.
+type DocumentUpload struct {
+	upload *Upload
+}
+
+func NewDocumentUpload(
+	userRepository user.Repository,
+	imageRepository img.Repository,
+	contentStore *storage.ContentStore,
+	limits TierLimits,
+) *DocumentUpload {
+	return &DocumentUpload{
+		NewUpload(userRepository, imageRepository, contentStore, limits),
+	}
+}
+
+// Do stores a document held in memory, see DoSpool.
+func (u *DocumentUpload) Do(
+	ctx context.Context,
+	userID uuid.UUID,
+	docFile []byte,
+	metadata *ImageMetadata,
+) (*models.Image, error) {
+	spool, err := storage.NewSpool(bytes.NewReader(docFile))
+	if err != nil {
+		return nil, err
+	}
+	defer spool.Close()
+
+	return u.DoSpool(ctx, userID, spool, metadata)
+}
+
+// DoSpool stores a document spooled to disk. Its dimensions, palette and
+// hash are the ones of the first page.
+func (u *DocumentUpload) DoSpool(
+	ctx context.Context,
+	userID uuid.UUID,
+	spool *storage.Spool,
+	metadata *ImageMetadata,
+) (*models.Image, error) {
+	usr, err := u.upload.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	head, err := spool.Head(sniffSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isPDF(head) {
+		return nil, ErrInvalidDocument
+	}
+
+	firstPage, err := renderPDFFile(ctx, spool.Name(), 1, 0, 0, u.upload.limits.For(usr.Tier))
+	if err != nil {
+		// A missing poppler install or a canceled request is not the
+		// document's fault.
+		if errors.Is(err, exec.ErrNotFound) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		return nil, ErrInvalidDocument
+	}
+
+	return u.upload.store(ctx, usr, spool, firstPage, metadata)
+}
+
+// isPDF reports whether the data looks like a pdf document. The header may
+// be preceded by garbage, as readers tolerate it.
+func isPDF(data []byte) bool {
+	head := data[:min(len(data), 1024)]
+	return bytes.Contains(head, []byte("%PDF-"))
+}
+
+type pdfInfo struct {
+	pages int
+	// width and height of the page in points, with its rotation applied.
+	width, height float64
+}
+
+var (
+	pdfPagesRe    = regexp.MustCompile(`(?m)^Pages:\s+(\d+)`)
+	pdfPageSizeRe = regexp.MustCompile(`(?m)^Page\s+\d+ size:\s+([\d.]+) x ([\d.]+) pts`)
+	pdfPageRotRe  = regexp.MustCompile(`(?m)^Page\s+\d+ rot:\s+(\d+)`)
+)
+
+// readPDFInfo returns the number of pages of the document and the size of
+// the given page.
+func readPDFInfo(ctx context.Context, path string, page int) (*pdfInfo, error) {
+	p := strconv.Itoa(page)
+	out, err := exec.CommandContext(ctx, "pdfinfo", "-f", p, "-l", p, path).Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("pdfinfo failed: %w", ctx.Err())
+		}
+
+		return nil, fmt.Errorf("pdfinfo failed: %w", err)
+	}
+
+	match := pdfPagesRe.FindSubmatch(out)
+	if match == nil {
+		return nil, errors.New("pdfinfo: missing page count")
+	}
+
+	info := &pdfInfo{}
+	info.pages, _ = strconv.Atoi(string(match[1]))
+	if match := pdfPageSizeRe.FindSubmatch(out); match != nil {
+		info.width, _ = strconv.ParseFloat(string(match[1]), 64)
+		info.height, _ = strconv.ParseFloat(string(match[2]), 64)
+	}
+
+	if match := pdfPageRotRe.FindSubmatch(out); match != nil {
+		if rot, _ := strconv.Atoi(string(match[1])); rot%180 == 90 {
+			info.width, info.height = info.height, info.width
+		}
+	}
+
+	return info, nil
+}
+
+// renderPDFPage renders a page of the document, starting at 1, see
+// renderPDFFile.
+func renderPDFPage(
+	ctx context.Context,
+	data []byte,
+	page, width, height int,
+	limits Limits,
+) (image.Image, error) {
+	dir, err := os.MkdirTemp("", "imago-pdf-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "document.pdf")
+	if err := os.WriteFile(src, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write document: %w", err)
+	}
+
+	return renderPDFFile(ctx, src, page, width, height, limits)
+}
+
+// renderPDFFile renders a page of the document at path, starting at 1.
+// Like svgs, a zero width or height is derived from the other using the
+// aspect ratio of the page, both zero render the page at pdfDPI, and the
+// size is reduced to fit the limits. Poppler is killed when ctx is done or
+// after pdfTimeout.
+func renderPDFFile(
+	ctx context.Context,
+	src string,
+	page, width, height int,
+	limits Limits,
+) (image.Image, error) {
+	page = max(page, 1)
+
+	ctx, cancel := context.WithTimeout(ctx, pdfTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "imago-pdf-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	info, err := readPDFInfo(ctx, src, page)
+	if err != nil {
+		return nil, err
+	}
+
+	if page > info.pages {
+		return nil, fmt.Errorf("%w: the document has %d pages", ErrPageOutOfRange, info.pages)
+	}
+
+	p := strconv.Itoa(page)
+	dstW, dstH := pdfRenderSize(info, width, height, limits)
+	dst := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(
+		ctx,
+		"pdftoppm",
+		"-f", p, "-l", p,
+		"-scale-to-x", strconv.Itoa(dstW),
+		"-scale-to-y", strconv.Itoa(dstH),
+		"-png", "-singlefile",
+		src, dst,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("pdftoppm failed: %w", ctx.Err())
+		}
+
+		return nil, fmt.Errorf("pdftoppm failed: %w: %s", err, out)
+	}
+
+	pageFile, err := os.Open(dst + ".png")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rendered page: %w", err)
+	}
+	defer pageFile.Close()
+
+	img, _, err := image.Decode(pageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rendered page: %w", err)
+	}
+
+	return img, nil
+}
+
+// pdfRenderSize returns the size in pixels that covers the requested size,
+// capped like svgs at maxRasterSize and the limits.
+func pdfRenderSize(info *pdfInfo, width, height int, limits Limits) (int, int) {
+	// Page sizes are in points, 72 per inch.
+	w, h := info.width, info.height
+	if w <= 0 || h <= 0 {
+		w, h = 612, 792
+	}
+
+	scale := pdfDPI / 72.0
+	switch {
+	case width > 0 && height > 0:
+		scale = math.Max(float64(width)/w, float64(height)/h)
+	case width > 0:
+		scale = float64(width) / w
+	case height > 0:
+		scale = float64(height) / h
+	}
+	return rasterSize(w, h, scale, limits)
+}
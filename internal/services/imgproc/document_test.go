@@ -0,0 +1,144 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+)
+
+func TestDocumentUpload(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := user.NewMemoryRepo()
+	imgRepo := img.NewMemoryRepo()
+	contentStore := storage.NewContentStore(storage.NewFSImageStorage("test_data", ""), blob.NewMemoryRepo())
+
+	usr, _ := userRepo.Create(ctx, models.User{
+		Username:     "test",
+		PasswordHash: "test",
+	})
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./test_data/blobs")
+	})
+
+	upload := imgproc.NewDocumentUpload(userRepo, imgRepo, contentStore, imgproc.TierLimits{})
+
+	t.Run("rejects other files", func(t *testing.T) {
+		_, err := upload.Do(ctx, usr.ID, []byte("not a pdf"), &imgproc.ImageMetadata{
+			Filename: "document.pdf",
+			Format:   "pdf",
+		})
+		if !errors.Is(err, imgproc.ErrInvalidDocument) {
+			t.Errorf("expected ErrInvalidDocument, got %v", err)
+		}
+	})
+
+	for _, tool := range []string{"pdftoppm", "pdfinfo"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+
+	imgInfo, err := upload.Do(ctx, usr.ID, samplePDF(t), &imgproc.ImageMetadata{
+		Filename: "document.pdf",
+		Format:   "pdf",
+	})
+	if err != nil {
+		t.Fatalf("could not upload document: %v", err)
+	}
+
+	t.Run("extracts properties", func(t *testing.T) {
+		if imgInfo.Metadata.Pages != 2 {
+			t.Errorf("expected 2 pages, got %d", imgInfo.Metadata.Pages)
+		}
+
+		// 200x100 points at 150 dpi.
+		if imgInfo.Width != 417 || imgInfo.Height != 208 {
+			t.Errorf("expected 417x208, got %dx%d", imgInfo.Width, imgInfo.Height)
+		}
+	})
+
+	sut := imgproc.NewDelivery(userRepo, imgRepo, contentStore, imgproc.TierLimits{}, false)
+
+	t.Run("renders the requested page", func(t *testing.T) {
+		imgData, format, err := sut.Do(ctx, usr.ID, "document.pdf", &imgproc.Transformations{
+			Resize: imgproc.Resize{Width: 100},
+			Page:   2,
+		}, "")
+		if err != nil {
+			t.Fatalf("could not deliver document: %v", err)
+		}
+
+		if format != "png" {
+			t.Errorf("expected documents to be delivered as png by default, got %s", format)
+		}
+
+		got, err := png.Decode(bytes.NewReader(imgData))
+		if err != nil {
+			t.Fatalf("failed to decode png: %v", err)
+		}
+
+		if got.Bounds().Dx() != 100 || got.Bounds().Dy() != 50 {
+			t.Errorf("expected 100x50, got %v", got.Bounds().Size())
+		}
+
+		if !isColor(got, image.Pt(50, 25), 0, 0, 0xff) {
+			t.Errorf("expected the blue second page, got %v", got.At(50, 25))
+		}
+	})
+
+	t.Run("page out of range", func(t *testing.T) {
+		_, _, err := sut.Do(ctx, usr.ID, "document.pdf", &imgproc.Transformations{
+			Page: 3,
+		}, "")
+		if !errors.Is(err, imgproc.ErrPageOutOfRange) {
+			t.Errorf("expected ErrPageOutOfRange, got %v", err)
+		}
+	})
+}
+
+// samplePDF returns a pdf with two 200x100 points pages, a red one and a
+// blue one.
+func samplePDF(t *testing.T) []byte {
+	t.Helper()
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 100] /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 100] /Contents 6 0 R >>",
+	}
+	for _, fill := range []string{"1 0 0 rg 0 0 200 100 re f", "0 0 1 rg 0 0 200 100 re f"} {
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(fill), fill))
+	}
+
+	buf := bytes.NewBufferString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes()
+}
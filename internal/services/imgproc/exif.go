@@ -0,0 +1,194 @@
+package imgproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+const (
+	MetadataStrip = "strip"
+	// MetadataKeep copies the EXIF and ICC profile of the original.
+	MetadataKeep = "keep"
+	// MetadataKeepICC only copies the ICC profile, dropping EXIF data such
+	// as the GPS position.
+	MetadataKeepICC = "keep_icc"
+)
+
+// orientation reads the EXIF orientation of the image, from 1 to 8. Images
+// without EXIF data are reported as 1, the normal orientation.
+func orientation(imgData []byte) int {
+	x, err := exif.Decode(bytes.NewReader(imgData))
+	if err != nil {
+		return 1
+	}
+
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+
+	o, err := tag.Int(0)
+	if err != nil || o < 1 || o > 8 {
+		return 1
+	}
+
+	return o
+}
+
+// orient applies the EXIF orientation so the image is displayed upright
+// without relying on the metadata.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5 to 8 swap the width and the height.
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+
+	return dst
+}
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// jpegMetadata returns the EXIF (APP1) and ICC profile (APP2) segments of a
+// jpeg, including their markers. It returns nothing for other formats.
+func jpegMetadata(imgData []byte) (exifSegment []byte, iccSegments [][]byte) {
+	if len(imgData) < 4 || imgData[0] != 0xff || imgData[1] != 0xd8 {
+		return nil, nil
+	}
+
+	for i := 2; i+4 <= len(imgData) && imgData[i] == 0xff; {
+		marker := imgData[i+1]
+		// Metadata always comes before the image data.
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(imgData[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(imgData) {
+			break
+		}
+
+		payload := imgData[i+4 : end]
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(payload, exifHeader):
+			exifSegment = bytes.Clone(imgData[i:end])
+		case marker == 0xe2 && bytes.HasPrefix(payload, iccHeader):
+			iccSegments = append(iccSegments, bytes.Clone(imgData[i:end]))
+		}
+
+		i = end
+	}
+
+	return exifSegment, iccSegments
+}
+
+// copyMetadata inserts the metadata of the original jpeg into the encoded
+// jpeg according to the metadata option. The EXIF orientation is reset, since
+// it was already applied to the pixels.
+func copyMetadata(original, encoded []byte, metadata string) []byte {
+	if metadata != MetadataKeep && metadata != MetadataKeepICC {
+		return encoded
+	}
+
+	exifSegment, iccSegments := jpegMetadata(original)
+
+	var segments []byte
+	if metadata == MetadataKeep && exifSegment != nil {
+		resetOrientation(exifSegment[4+len(exifHeader):])
+		segments = append(segments, exifSegment...)
+	}
+
+	for _, segment := range iccSegments {
+		segments = append(segments, segment...)
+	}
+
+	if len(segments) == 0 || len(encoded) < 2 {
+		return encoded
+	}
+
+	// Segments go right after the start of image marker.
+	result := make([]byte, 0, len(encoded)+len(segments))
+	result = append(result, encoded[:2]...)
+	result = append(result, segments...)
+	return append(result, encoded[2:]...)
+}
+
+// resetOrientation sets the orientation tag of the first IFD of the TIFF
+// encoded EXIF data to 1, in place.
+func resetOrientation(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := range entries {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return
+		}
+
+		// Orientation is a single SHORT stored inline in the value field.
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			order.PutUint16(tiff[entry+8:], 1)
+			return
+		}
+	}
+}
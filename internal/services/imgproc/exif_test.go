@@ -0,0 +1,178 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func TestOrientationAndMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := user.NewMemoryRepo()
+	imgRepo := img.NewMemoryRepo()
+	imageStore := storage.NewContentStore(storage.NewFSImageStorage("test_data", ""), blob.NewMemoryRepo())
+
+	usr, _ := userRepo.Create(ctx, models.User{
+		Username:     "test",
+		PasswordHash: "test",
+	})
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./test_data/blobs")
+	})
+
+	upload := imgproc.NewUpload(userRepo, imgRepo, imageStore, imgproc.TierLimits{})
+	_, err := upload.Do(ctx, usr.ID, rotatedJpeg(t), &imgproc.ImageMetadata{
+		Filename: "rotated.jpg",
+		Format:   "jpeg",
+		Alt:      "rotated",
+	})
+	if err != nil {
+		t.Fatalf("could not upload image: %v", err)
+	}
+
+	sut := imgproc.NewDelivery(userRepo, imgRepo, imageStore, imgproc.TierLimits{}, false)
+	deliver := func(t *testing.T, output imgproc.Output) []byte {
+		t.Helper()
+
+		imgData, _, err := sut.Do(ctx, usr.ID, "rotated.jpg", &imgproc.Transformations{
+			Format: "jpeg",
+			Output: output,
+		}, "")
+		if err != nil {
+			t.Fatalf("could not deliver image: %v", err)
+		}
+
+		return imgData
+	}
+
+	t.Run("applies orientation", func(t *testing.T) {
+		got, err := jpeg.Decode(bytes.NewReader(deliver(t, imgproc.Output{})))
+		if err != nil {
+			t.Fatalf("failed to decode image: %v", err)
+		}
+
+		if got.Bounds().Dx() != 20 || got.Bounds().Dy() != 40 {
+			t.Fatalf("expected image to be 20x40, got %v", got.Bounds().Size())
+		}
+
+		// The left half of the stored image is red, rotating it clockwise
+		// moves it to the top.
+		if r, _, b, _ := got.At(10, 5).RGBA(); r>>8 < 200 || b>>8 > 50 {
+			t.Errorf("expected red on top, got %v", got.At(10, 5))
+		}
+	})
+
+	t.Run("strips metadata", func(t *testing.T) {
+		imgData := deliver(t, imgproc.Output{})
+		if _, err := exif.Decode(bytes.NewReader(imgData)); err == nil {
+			t.Error("expected no exif data")
+		}
+
+		if bytes.Contains(imgData, []byte("ICC_PROFILE")) {
+			t.Error("expected no icc profile")
+		}
+	})
+
+	t.Run("keeps metadata", func(t *testing.T) {
+		imgData := deliver(t, imgproc.Output{Metadata: imgproc.MetadataKeep})
+		x, err := exif.Decode(bytes.NewReader(imgData))
+		if err != nil {
+			t.Fatalf("expected exif data: %v", err)
+		}
+
+		tag, err := x.Get(exif.Orientation)
+		if err != nil {
+			t.Fatalf("expected orientation tag: %v", err)
+		}
+
+		if o, _ := tag.Int(0); o != 1 {
+			t.Errorf("expected orientation to be reset to 1, got %d", o)
+		}
+
+		if !bytes.Contains(imgData, []byte("ICC_PROFILE")) {
+			t.Error("expected icc profile")
+		}
+
+		if _, err := jpeg.Decode(bytes.NewReader(imgData)); err != nil {
+			t.Errorf("failed to decode image: %v", err)
+		}
+	})
+
+	t.Run("keeps icc profile only", func(t *testing.T) {
+		imgData := deliver(t, imgproc.Output{Metadata: imgproc.MetadataKeepICC})
+		if _, err := exif.Decode(bytes.NewReader(imgData)); err == nil {
+			t.Error("expected no exif data")
+		}
+
+		if !bytes.Contains(imgData, []byte("ICC_PROFILE")) {
+			t.Error("expected icc profile")
+		}
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		_, _, err := sut.Do(ctx, usr.ID, "rotated.jpg", &imgproc.Transformations{
+			Format: "png",
+			Output: imgproc.Output{Metadata: imgproc.MetadataKeep},
+		}, "")
+		if !errors.Is(err, imgproc.ErrInvalidOutput) {
+			t.Errorf("expected ErrInvalidOutput, got %v", err)
+		}
+	})
+}
+
+// rotatedJpeg returns a 40x20 jpeg, red on the left and blue on the right,
+// with an EXIF orientation of 6 (rotate 90 degrees clockwise) and a dummy
+// ICC profile.
+func rotatedJpeg(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := range 20 {
+		for x := range 40 {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < 20 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2a, 0x00, 0x00, 0x00, 0x08, // header, first IFD at 8
+		0x00, 0x01, // one entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, 0x06, 0x00, 0x00, // orientation = 6
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+
+	var segments []byte
+	segments = append(segments, segment(0xe1, append([]byte("Exif\x00\x00"), tiff...))...)
+	segments = append(segments, segment(0xe2, append([]byte("ICC_PROFILE\x00\x01\x01"), "profile"...))...)
+
+	encoded := buf.Bytes()
+	return append(append(encoded[:2:2], segments...), encoded[2:]...)
+}
+
+func segment(marker byte, payload []byte) []byte {
+	length := len(payload) + 2
+	return append([]byte{0xff, marker, byte(length >> 8), byte(length)}, payload...)
+}
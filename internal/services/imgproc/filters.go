@@ -0,0 +1,103 @@
+package imgproc
+
+import (
+	"image"
+
+	"github.com/anthonynsimon/bild/adjust"
+	"github.com/anthonynsimon/bild/blur"
+	"github.com/anthonynsimon/bild/effect"
+)
+
+// Filters are applied in a fixed order: denoise, color adjustments, color
+// effects, blur, sharpening, emboss and edge detection. Zero values leave
+// the image unchanged.
+type Filters struct {
+	Grayscale bool `json:"grayscale"`
+	Sepia     bool `json:"sepia"`
+	Invert    bool `json:"invert"`
+	Emboss    bool `json:"emboss"`
+	Sharpen   bool `json:"sharpen"`
+
+	// Blur is the gaussian blur radius.
+	Blur        float64      `json:"blur" validate:"gte=0,lte=50"`
+	UnsharpMask *UnsharpMask `json:"unsharpMask"`
+
+	// Brightness, Contrast and Saturation are relative changes from -1 to 1.
+	Brightness float64 `json:"brightness" validate:"gte=-1,lte=1"`
+	Contrast   float64 `json:"contrast" validate:"gte=-1,lte=1"`
+	Saturation float64 `json:"saturation" validate:"gte=-1,lte=1"`
+	// Gamma is the gamma correction, 1 leaves the image unchanged.
+	Gamma float64 `json:"gamma" validate:"omitempty,gt=0,lte=10"`
+	// Hue shifts the hue by the given degrees.
+	Hue int `json:"hue" validate:"gte=-360,lte=360"`
+
+	// EdgeDetection is the radius of the edge detection kernel.
+	EdgeDetection float64 `json:"edgeDetection" validate:"gte=0,lte=10"`
+	// Denoise is the radius of the median filter.
+	Denoise float64 `json:"denoise" validate:"gte=0,lte=10"`
+}
+
+type UnsharpMask struct {
+	Radius float64 `json:"radius" validate:"gt=0,lte=50"`
+	Amount float64 `json:"amount" validate:"gt=0,lte=10"`
+}
+
+func applyFilters(img image.Image, f *Filters) image.Image {
+	if f.Denoise > 0 {
+		img = effect.Median(img, f.Denoise)
+	}
+
+	if f.Brightness != 0 {
+		img = adjust.Brightness(img, f.Brightness)
+	}
+
+	if f.Contrast != 0 {
+		img = adjust.Contrast(img, f.Contrast)
+	}
+
+	if f.Gamma > 0 && f.Gamma != 1 {
+		img = adjust.Gamma(img, f.Gamma)
+	}
+
+	if f.Saturation != 0 {
+		img = adjust.Saturation(img, f.Saturation)
+	}
+
+	if f.Hue != 0 {
+		img = adjust.Hue(img, f.Hue)
+	}
+
+	if f.Grayscale {
+		img = effect.Grayscale(img)
+	}
+
+	if f.Sepia {
+		img = effect.Sepia(img)
+	}
+
+	if f.Invert {
+		img = effect.Invert(img)
+	}
+
+	if f.Blur > 0 {
+		img = blur.Gaussian(img, f.Blur)
+	}
+
+	if f.Sharpen {
+		img = effect.Sharpen(img)
+	}
+
+	if f.UnsharpMask != nil {
+		img = effect.UnsharpMask(img, f.UnsharpMask.Radius, f.UnsharpMask.Amount)
+	}
+
+	if f.Emboss {
+		img = effect.Emboss(img)
+	}
+
+	if f.EdgeDetection > 0 {
+		img = effect.EdgeDetection(img, f.EdgeDetection)
+	}
+
+	return img
+}
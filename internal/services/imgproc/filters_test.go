@@ -0,0 +1,84 @@
+package imgproc_test
+
+import (
+	"image"
+	"testing"
+
+	"github.com/anthonynsimon/bild/imgio"
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestFilters(t *testing.T) {
+	img, err := imgio.Open("./test_data/flowers.jpg")
+	if err != nil {
+		t.Fatalf("failed to open image file: %v", err)
+	}
+	img = transform.Resize(img, 150, 100, transform.Linear)
+
+	testCases := map[string]imgproc.Filters{
+		"invert":         {Invert: true},
+		"emboss":         {Emboss: true},
+		"sharpen":        {Sharpen: true},
+		"blur":           {Blur: 3},
+		"unsharp mask":   {UnsharpMask: &imgproc.UnsharpMask{Radius: 2, Amount: 1}},
+		"brightness":     {Brightness: 0.3},
+		"contrast":       {Contrast: -0.5},
+		"saturation":     {Saturation: -1},
+		"gamma":          {Gamma: 2.2},
+		"hue":            {Hue: 180},
+		"edge detection": {EdgeDetection: 1},
+		"denoise":        {Denoise: 2},
+	}
+
+	for name, filters := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := imgproc.Transform(img, &imgproc.Transformations{Filters: filters})
+			if err != nil {
+				t.Fatalf("failed to transform image: %v", err)
+			}
+
+			if got.Bounds().Size() != img.Bounds().Size() {
+				t.Errorf("expected size %v, got %v", img.Bounds().Size(), got.Bounds().Size())
+			}
+
+			if samePixels(img, got) {
+				t.Error("expected the filter to change the image")
+			}
+		})
+	}
+
+	t.Run("invalid ranges", func(t *testing.T) {
+		validate := validator.New(validator.WithRequiredStructEnabled())
+		invalid := []imgproc.Filters{
+			{Blur: -1},
+			{Brightness: 2},
+			{Gamma: -1},
+			{Hue: 400},
+			{Denoise: 50},
+			{UnsharpMask: &imgproc.UnsharpMask{Radius: 0, Amount: 1}},
+		}
+
+		for _, filters := range invalid {
+			if err := validate.Struct(filters); err == nil {
+				t.Errorf("expected %+v to be invalid", filters)
+			}
+		}
+	})
+}
+
+func samePixels(a, b image.Image) bool {
+	ab, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
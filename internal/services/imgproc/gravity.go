@@ -0,0 +1,168 @@
+package imgproc
+
+import (
+	"image"
+	"math"
+
+	"github.com/anthonynsimon/bild/transform"
+)
+
+const (
+	GravityCenter    = "center"
+	GravityNorth     = "north"
+	GravitySouth     = "south"
+	GravityEast      = "east"
+	GravityWest      = "west"
+	GravityNorthEast = "north-east"
+	GravityNorthWest = "north-west"
+	GravitySouthEast = "south-east"
+	GravitySouthWest = "south-west"
+	// GravityAuto places the window over the most detailed region of the
+	// image, measured by its edge energy.
+	GravityAuto = "auto"
+)
+
+// gravityOffsets are the relative positions of the window in the free space
+// around it, from 0 (left/top) to 1 (right/bottom).
+var gravityOffsets = map[string][2]float64{
+	GravityCenter:    {0.5, 0.5},
+	GravityNorth:     {0.5, 0},
+	GravitySouth:     {0.5, 1},
+	GravityEast:      {1, 0.5},
+	GravityWest:      {0, 0.5},
+	GravityNorthEast: {1, 0},
+	GravityNorthWest: {0, 0},
+	GravitySouthEast: {1, 1},
+	GravitySouthWest: {0, 1},
+}
+
+// anchors keeps the windows placed with GravityAuto, keyed by the step
+// that placed them. Frames of an animation share them, so every frame is
+// cropped where the first one was instead of jumping around.
+type anchors map[any]image.Point
+
+// anchor places the window like the anchor function, but windows placed
+// with GravityAuto are computed once per key. Nil anchors place every
+// window anew.
+func (a anchors) anchor(key any, img image.Image, size image.Point, gravity string) image.Point {
+	if a == nil || gravity != GravityAuto {
+		return anchor(img, size, gravity)
+	}
+
+	if origin, ok := a[key]; ok {
+		return origin
+	}
+
+	origin := anchor(img, size, gravity)
+	a[key] = origin
+	return origin
+}
+
+// cropGravity crops a width x height window placed according to gravity,
+// see anchors for key.
+func cropGravity(img image.Image, width, height int, gravity string, pins anchors, key any) image.Image {
+	bounds := img.Bounds()
+	size := image.Pt(min(width, bounds.Dx()), min(height, bounds.Dy()))
+	origin := pins.anchor(key, img, size, gravity)
+
+	return transform.Crop(img, image.Rectangle{Min: origin, Max: origin.Add(size)})
+}
+
+// anchor returns the top left corner of a window of the given size placed
+// inside the image according to gravity. Unknown gravities are centered.
+func anchor(img image.Image, size image.Point, gravity string) image.Point {
+	bounds := img.Bounds()
+	if gravity == GravityAuto {
+		return bounds.Min.Add(mostDetailedWindow(img, size))
+	}
+
+	offset, ok := gravityOffsets[gravity]
+	if !ok {
+		offset = gravityOffsets[GravityCenter]
+	}
+
+	free := bounds.Size().Sub(size)
+	return bounds.Min.Add(image.Pt(
+		int(math.Round(float64(free.X)*offset[0])),
+		int(math.Round(float64(free.Y)*offset[1])),
+	))
+}
+
+// energySampleSize is the longest side of the thumbnail used to measure
+// edge energy, which keeps the analysis cheap for large images.
+const energySampleSize = 128
+
+// mostDetailedWindow returns the offset of the window with the highest edge
+// energy. Ties are resolved towards the center of the image.
+func mostDetailedWindow(img image.Image, size image.Point) image.Point {
+	bounds := img.Bounds()
+	scale := min(1, float64(energySampleSize)/float64(max(bounds.Dx(), bounds.Dy())))
+	sampleW := max(1, int(float64(bounds.Dx())*scale))
+	sampleH := max(1, int(float64(bounds.Dy())*scale))
+	sample := transform.Resize(img, sampleW, sampleH, transform.Box)
+
+	integral := energyIntegral(sample)
+	winW := min(sampleW, max(1, int(math.Round(float64(size.X)*scale))))
+	winH := min(sampleH, max(1, int(math.Round(float64(size.Y)*scale))))
+
+	centerX, centerY := float64(sampleW-winW)/2, float64(sampleH-winH)/2
+	best, bestEnergy, bestDistance := image.Point{}, -1.0, math.Inf(1)
+	for y := 0; y <= sampleH-winH; y++ {
+		for x := 0; x <= sampleW-winW; x++ {
+			energy := integral[y+winH][x+winW] - integral[y][x+winW] -
+				integral[y+winH][x] + integral[y][x]
+			distance := math.Hypot(float64(x)-centerX, float64(y)-centerY)
+
+			if energy > bestEnergy || (energy == bestEnergy && distance < bestDistance) {
+				best, bestEnergy, bestDistance = image.Pt(x, y), energy, distance
+			}
+		}
+	}
+
+	origin := image.Pt(
+		int(math.Round(float64(best.X)/scale)),
+		int(math.Round(float64(best.Y)/scale)),
+	)
+
+	free := bounds.Size().Sub(size)
+	return image.Pt(min(origin.X, free.X), min(origin.Y, free.Y))
+}
+
+// energyIntegral computes the summed area table of the gradient magnitude
+// of the image luminance.
+func energyIntegral(img *image.RGBA) [][]float64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	luma := make([]float64, w*h)
+	for y := range h {
+		for x := range w {
+			i := img.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			p := img.Pix[i : i+3 : i+3]
+			luma[y*w+x] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+		}
+	}
+
+	integral := make([][]float64, h+1)
+	for y := range integral {
+		integral[y] = make([]float64, w+1)
+	}
+
+	for y := range h {
+		rowSum := 0.0
+		for x := range w {
+			var dx, dy float64
+			if x+1 < w {
+				dx = luma[y*w+x+1] - luma[y*w+x]
+			}
+			if y+1 < h {
+				dy = luma[(y+1)*w+x] - luma[y*w+x]
+			}
+
+			rowSum += math.Abs(dx) + math.Abs(dy)
+			integral[y+1][x+1] = integral[y][x+1] + rowSum
+		}
+	}
+
+	return integral
+}
@@ -0,0 +1,84 @@
+package imgproc_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/services/imgproc"
+)
+
+func TestCropGravity(t *testing.T) {
+	// White canvas with a detailed checkerboard in the bottom right corner.
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for y := range 200 {
+		for x := range 300 {
+			c := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			if x >= 220 && y >= 120 && (x/4+y/4)%2 == 0 {
+				c = color.RGBA{A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	testCases := []struct {
+		gravity string
+		want    image.Point
+	}{
+		{imgproc.GravityCenter, image.Pt(125, 75)},
+		{imgproc.GravityNorthWest, image.Pt(0, 0)},
+		{imgproc.GravitySouthEast, image.Pt(250, 150)},
+		{imgproc.GravityNorth, image.Pt(125, 0)},
+		{imgproc.GravityWest, image.Pt(0, 75)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.gravity, func(t *testing.T) {
+			transformed, err := imgproc.Transform(img, &imgproc.Transformations{
+				Crop: imgproc.Crop{Width: 50, Height: 50, Gravity: tc.gravity},
+			})
+			if err != nil {
+				t.Fatalf("failed to transform image: %v", err)
+			}
+
+			got := transformed.Bounds()
+			if got.Min != tc.want || got.Dx() != 50 || got.Dy() != 50 {
+				t.Errorf("expected 50x50 crop at %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	t.Run(imgproc.GravityAuto, func(t *testing.T) {
+		transformed, err := imgproc.Transform(img, &imgproc.Transformations{
+			Crop: imgproc.Crop{Width: 60, Height: 60, Gravity: imgproc.GravityAuto},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		got := transformed.Bounds()
+		detail := image.Rect(220, 120, 300, 200)
+		if !got.In(detail) {
+			t.Errorf("expected crop %v to be inside the detailed region %v", got, detail)
+		}
+	})
+
+	t.Run("cover", func(t *testing.T) {
+		transformed, err := imgproc.Transform(img, &imgproc.Transformations{
+			Resize: imgproc.Resize{
+				Width:   100,
+				Height:  200,
+				Fit:     imgproc.FitCover,
+				Gravity: imgproc.GravityEast,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		got := transformed.Bounds()
+		if got.Dx() != 100 || got.Dy() != 200 || got.Max.X != 300 {
+			t.Errorf("expected a 100x200 crop on the east side, got %v", got)
+		}
+	})
+}
@@ -3,122 +3,208 @@ package imgproc
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"image"
 	"io"
-	"log/slog"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/edulustosa/imago/internal/database/models"
 	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
 	"github.com/edulustosa/imago/internal/storage"
 	"github.com/google/uuid"
 )
 
 type ImageTransformation struct {
-	imageRepository img.Repository
-	imageStorage    storage.ImageStorage
+	userRepository    user.Repository
+	imageRepository   img.Repository
+	variantRepository img.VariantRepository
+	contentStore      *storage.ContentStore
+	limits            TierLimits
 }
 
 func NewImageTransformation(
+	userRepository user.Repository,
 	imageRepository img.Repository,
-	imageStorage storage.ImageStorage,
+	variantRepository img.VariantRepository,
+	contentStore *storage.ContentStore,
+	limits TierLimits,
 ) *ImageTransformation {
 	return &ImageTransformation{
+		userRepository,
 		imageRepository,
-		imageStorage,
+		variantRepository,
+		contentStore,
+		limits,
 	}
 }
 
 var ErrImageNotFound = errors.New("image not found: invalid image or user id")
 
+// Transform applies the transformations to the original image and stores the
+// result as a new variant. The original image is never modified. accept
+// lists the formats FormatAuto is negotiated against, like an Accept header.
+// The variant keeps FormatAuto in its transformations and the negotiated
+// format as its format.
 func (it *ImageTransformation) Transform(
 	ctx context.Context,
 	imageID int,
 	userID uuid.UUID,
 	t *Transformations,
-) (*models.Image, error) {
+	accept string,
+) (*models.ImageVariant, error) {
+	usr, err := it.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return nil, ErrImageNotFound
+	}
+
 	imgInfo, err := it.imageRepository.FindByID(ctx, imageID, userID)
 	if err != nil {
 		return nil, ErrImageNotFound
 	}
 
-	imgFile, err := it.imageStorage.DownloadImage(
-		ctx,
-		fmt.Sprintf("%s/%s", userID.String(), imgInfo.Filename),
-	)
+	err = loadWatermarks(ctx, it.imageRepository, it.contentStore, userID, t, false)
 	if err != nil {
 		return nil, err
 	}
-	defer imgFile.Close()
 
-	processedImgData, err := processImage(imgFile, t)
+	imgFile, err := it.contentStore.DownloadImage(ctx, imgInfo.StorageKey)
 	if err != nil {
 		return nil, err
 	}
+	defer imgFile.Close()
 
-	filename := imgInfo.Filename
-	if imgInfo.Format != t.Format {
-		go it.deleteOriginalImage(userID, imgInfo.Filename)
-		filename = changeFileExtension(filename, t.Format)
+	// Marshalled before processing, which replaces FormatAuto by the
+	// negotiated format.
+	transformations, err := json.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal transformations: %w", err)
+	}
+
+	processedImgData, err := processImage(ctx, imgFile, t, accept, it.limits.For(usr.Tier))
+	if err != nil {
+		return nil, err
 	}
 
-	imgURL, err := it.imageStorage.Upload(
-		ctx,
-		processedImgData,
-		fmt.Sprintf("%s/%s", userID.String(), filename),
-	)
+	key, imgURL, err := it.contentStore.Put(ctx, processedImgData)
 	if err != nil {
 		return nil, err
 	}
 
-	return it.imageRepository.Update(ctx, imageID, userID, models.Image{
-		ImageURL: imgURL,
-		Filename: filename,
-		Format:   t.Format,
-		Alt:      imgInfo.Alt,
+	variant, err := it.variantRepository.Create(ctx, models.ImageVariant{
+		ImageID:         imgInfo.ID,
+		UserID:          userID,
+		ImageURL:        imgURL,
+		Filename:        variantFilename(imgInfo.Filename, t.Format),
+		Format:          t.Format,
+		Transformations: transformations,
+		StorageKey:      key,
 	})
+	if err != nil {
+		_ = it.contentStore.Release(ctx, key)
+		return nil, err
+	}
+
+	return variant, nil
 }
 
-func processImage(imgFile io.Reader, t *Transformations) ([]byte, error) {
-	img, _, err := image.Decode(imgFile)
+// processImage decodes, transforms and encodes the image. The EXIF
+// orientation is applied before any other step. Animated gifs are transformed
+// frame by frame when the output is a gif. When the format is FormatAuto it is negotiated against
+// accept and t.Format is updated with the chosen format. Both the image and
+// the images produced by the pipeline are checked against the limits before
+// being allocated.
+func processImage(
+	ctx context.Context,
+	imgFile io.Reader,
+	t *Transformations,
+	accept string,
+	limits Limits,
+) ([]byte, error) {
+	imgData, err := io.ReadAll(imgFile)
 	if err != nil {
-		fmt.Println("is here")
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+		return nil, fmt.Errorf("failed to read image: %w", err)
 	}
 
-	img = Transform(img, t)
-	imgBuff := new(bytes.Buffer)
-	if err := Encode(imgBuff, img, t.Format); err != nil {
+	if err := limits.checkData(bytes.NewReader(imgData)); err != nil {
 		return nil, err
 	}
 
-	return imgBuff.Bytes(), nil
-}
+	f, err := decodeFrames(ctx, imgData, t, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.selectFrame(&t.Animation); err != nil {
+		return nil, err
+	}
+
+	// Decoders that don't declare their size upfront are checked once done.
+	bounds := f.bounds()
+	if err := limits.check(bounds.Dx(), bounds.Dy(), f.len()); err != nil {
+		return nil, err
+	}
+
+	if err := limits.checkPipeline(t, bounds.Dx(), bounds.Dy()); err != nil {
+		return nil, err
+	}
 
-func (it *ImageTransformation) deleteOriginalImage(userID uuid.UUID, filename string) {
-	const timeout = 5 * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	opts := t.Output
+	imgBuff := new(bytes.Buffer)
+	if f.animated() && (t.Format == FormatAuto || t.Format == "gif") {
+		// Only gif keeps the animation.
+		if t.Format == FormatAuto {
+			t.Format = "gif"
+			opts = opts.forFormat(t.Format)
+		}
+
+		if err := opts.validate(t.Format); err != nil {
+			return nil, err
+		}
+
+		// Smart crops are placed on the first frame and reused by the
+		// others. Frames are quantized as soon as they are transformed.
+		pins := anchors{}
+		enc := newGifEncoder(f, &opts)
+		for _, img := range f.all() {
+			transformed, err := transformFrame(img, t, pins)
+			if err != nil {
+				return nil, err
+			}
+			enc.add(transformed)
+		}
+
+		if err := enc.encode(imgBuff); err != nil {
+			return nil, err
+		}
+
+		return imgBuff.Bytes(), nil
+	}
 
-	err := it.imageStorage.Delete(
-		ctx,
-		fmt.Sprintf("%s/%s", userID.String(), filename),
-	)
+	// Static formats only get the first frame.
+	f.keep(0)
+	img, err := transformFrame(f.images[0], t, anchors{})
 	if err != nil {
-		slog.Error(
-			"failed to delete original image",
-			"msg", err,
-			"user id", userID,
-			"image", filename,
-		)
+		return nil, err
+	}
+
+	if t.Format == FormatAuto {
+		t.Format = NegotiateFormat(accept, img)
+		opts = opts.forFormat(t.Format)
 	}
+
+	if err := Encode(imgBuff, img, t.Format, &opts); err != nil {
+		return nil, err
+	}
+
+	return copyMetadata(imgData, imgBuff.Bytes(), opts.Metadata), nil
 }
 
-func changeFileExtension(filename, newExt string) string {
+// variantFilename derives a unique filename for a variant from the original
+// filename, e.g. "flowers.jpg" becomes "flowers_<uuid>.webp".
+func variantFilename(filename, format string) string {
 	base := strings.TrimSuffix(filename, filepath.Ext(filename))
-	return fmt.Sprintf("%s.%s", base, newExt)
+	return fmt.Sprintf("%s_%s.%s", base, uuid.NewString(), format)
 }
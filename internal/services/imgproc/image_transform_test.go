@@ -0,0 +1,114 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+)
+
+func TestImageTransformation(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := user.NewMemoryRepo()
+	imgRepo := img.NewMemoryRepo()
+	variantRepo := img.NewMemoryVariantRepo()
+	imageStore := storage.NewContentStore(storage.NewFSImageStorage("test_data", ""), blob.NewMemoryRepo())
+
+	imgData, err := os.ReadFile("./test_data/flowers.jpg")
+	if err != nil {
+		t.Fatalf("could not read image file: %v", err)
+	}
+
+	usr, _ := userRepo.Create(ctx, models.User{
+		Username:     "test",
+		PasswordHash: "test",
+	})
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./test_data/blobs")
+	})
+
+	upload := imgproc.NewUpload(userRepo, imgRepo, imageStore, imgproc.TierLimits{})
+	imgInfo, err := upload.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+		Filename: "flowers.jpg",
+		Format:   "jpeg",
+		Alt:      "flowers",
+	})
+	if err != nil {
+		t.Fatalf("could not upload image: %v", err)
+	}
+
+	sut := imgproc.NewImageTransformation(userRepo, imgRepo, variantRepo, imageStore, imgproc.TierLimits{})
+
+	t.Run("creates variant", func(t *testing.T) {
+		variant, err := sut.Transform(ctx, imgInfo.ID, usr.ID, &imgproc.Transformations{
+			Resize: imgproc.Resize{Width: 50, Height: 50},
+			Format: "png",
+		}, "")
+		if err != nil {
+			t.Fatalf("could not transform image: %v", err)
+		}
+
+		if variant.ImageID != imgInfo.ID || variant.Format != "png" {
+			t.Errorf("unexpected variant: %+v", variant)
+		}
+
+		if _, err := os.Stat(variant.ImageURL); err != nil {
+			t.Errorf("could not find variant file: %v", err)
+		}
+
+		variants, _ := variantRepo.FindManyByImageID(ctx, imgInfo.ID, usr.ID)
+		if len(variants) != 1 {
+			t.Errorf("expected 1 variant, got %d", len(variants))
+		}
+	})
+
+	t.Run("keeps the auto format in the transformations", func(t *testing.T) {
+		variant, err := sut.Transform(ctx, imgInfo.ID, usr.ID, &imgproc.Transformations{
+			Resize: imgproc.Resize{Width: 50, Height: 50},
+			Format: imgproc.FormatAuto,
+		}, "")
+		if err != nil {
+			t.Fatalf("could not transform image: %v", err)
+		}
+
+		if variant.Format != "jpeg" {
+			t.Errorf("expected the negotiated jpeg format, got %s", variant.Format)
+		}
+
+		var stored imgproc.Transformations
+		if err := json.Unmarshal(variant.Transformations, &stored); err != nil {
+			t.Fatalf("failed to unmarshal transformations: %v", err)
+		}
+
+		if stored.Format != imgproc.FormatAuto {
+			t.Errorf("expected the requested auto format, got %s", stored.Format)
+		}
+	})
+
+	t.Run("keeps original", func(t *testing.T) {
+		original, err := os.ReadFile(filepath.Join("test_data", imgInfo.StorageKey))
+		if err != nil {
+			t.Fatalf("could not read original image: %v", err)
+		}
+
+		if !bytes.Equal(original, imgData) {
+			t.Error("expected original image to be unchanged")
+		}
+
+		stored, _ := imgRepo.FindByID(ctx, imgInfo.ID, usr.ID)
+		if stored.Format != "jpeg" || stored.Filename != "flowers.jpg" {
+			t.Errorf("expected image record to be unchanged, got %+v", stored)
+		}
+	})
+}
@@ -4,13 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
 
-	"github.com/anthonynsimon/bild/effect"
 	"github.com/anthonynsimon/bild/transform"
+	"github.com/gen2brain/avif"
+	_ "github.com/gen2brain/heic"
+	"github.com/kolesa-team/go-webp/encoder"
 	"github.com/kolesa-team/go-webp/webp"
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/tiff"
@@ -22,56 +26,71 @@ type Transformations struct {
 	Rotate  float64 `json:"rotate"`
 	Format  string  `json:"format" validate:"required"`
 	Filters Filters `json:"filters"`
-}
+	Output  Output  `json:"output"`
+
+	Watermark *Watermark `json:"watermark"`
+	Animation Animation  `json:"animation"`
+	// Page is the page of pdf documents to render, starting at 1. Zero
+	// renders the first page.
+	Page int `json:"page" validate:"gte=0"`
 
-type Resize struct {
-	Width  int `json:"width"`
-	Height int `json:"height"`
+	// Steps is an ordered list of operations. When set, the flat fields
+	// above except Format, Animation and Page are ignored and the steps run in sequence.
+	Steps []Step `json:"steps" validate:"dive"`
 }
 
 type Crop struct {
-	Width  int `json:"width"`
-	Height int `json:"height"`
-	X      int `json:"x"`
-	Y      int `json:"y"`
-}
+	Width  int `json:"width" validate:"gte=0"`
+	Height int `json:"height" validate:"gte=0"`
+	X      int `json:"x" validate:"gte=0"`
+	Y      int `json:"y" validate:"gte=0"`
 
-type Filters struct {
-	Grayscale bool `json:"grayscale"`
-	Sepia     bool `json:"sepia"`
+	// Gravity places the crop window instead of X and Y.
+	Gravity string `json:"gravity" validate:"omitempty,oneof=center north south east west north-east north-west south-east south-west auto"`
 }
 
-func Transform(img image.Image, t *Transformations) image.Image {
-	if t.Resize.Width > 0 || t.Resize.Height > 0 {
-		img = transform.Resize(img, t.Resize.Width, t.Resize.Height, transform.Linear)
-	}
+func Transform(img image.Image, t *Transformations) (image.Image, error) {
+	return transformFrame(img, t, nil)
+}
 
-	if t.Crop.Width > 0 && t.Crop.Height > 0 {
-		img = transform.Crop(
-			img,
-			image.Rect(
-				t.Crop.X,
-				t.Crop.Y,
-				t.Crop.X+t.Crop.Width,
-				t.Crop.Y+t.Crop.Height,
-			),
-		)
+// transformFrame is Transform for a frame of an animation, placing the
+// windows of GravityAuto with pins.
+func transformFrame(img image.Image, t *Transformations, pins anchors) (image.Image, error) {
+	for _, step := range t.pipeline() {
+		var err error
+		if img, err = step.apply(img, pins); err != nil {
+			return nil, err
+		}
 	}
 
-	img = transform.Rotate(img, t.Rotate, nil)
+	return img, nil
+}
 
-	if t.Filters.Grayscale {
-		img = effect.Grayscale(img)
+func crop(img image.Image, c *Crop, pins anchors) image.Image {
+	if c.Width <= 0 || c.Height <= 0 {
+		return img
 	}
 
-	if t.Filters.Sepia {
-		img = effect.Sepia(img)
+	if c.Gravity != "" {
+		return cropGravity(img, c.Width, c.Height, c.Gravity, pins, c)
 	}
 
-	return img
+	return transform.Crop(
+		img,
+		image.Rect(
+			c.X,
+			c.Y,
+			c.X+c.Width,
+			c.Y+c.Height,
+		),
+	)
 }
 
-type EncoderFunc func(io.Writer, image.Image) error
+func rotate(img image.Image, angle float64) image.Image {
+	return transform.Rotate(img, angle, nil)
+}
+
+type EncoderFunc func(io.Writer, image.Image, *Output) error
 
 var Encoders = map[string]EncoderFunc{
 	"jpeg": toJpeg,
@@ -82,43 +101,189 @@ var Encoders = map[string]EncoderFunc{
 	"tiff": toTiff,
 	"tif":  toTiff,
 	"webp": toWebp,
+	"avif": toAvif,
+}
+
+var ContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"jpg":  "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"bmp":  "image/bmp",
+	"tiff": "image/tiff",
+	"tif":  "image/tiff",
+	"webp": "image/webp",
+	"avif": "image/avif",
+	"heic": "image/heic",
+	"heif": "image/heif",
+	"svg":  "image/svg+xml",
+	"pdf":  "application/pdf",
 }
 
 var ErrUnsupportedFormat = errors.New("unsupported file format")
 
-func Encode(w io.Writer, img image.Image, format string) error {
+// SniffContentType returns the content type of the image or document read
+// from r, recognized by the decoders used on upload rather than by
+// http.DetectContentType, which doesn't know svgs, avif or heic. Unknown data
+// is application/octet-stream. r is rewound once done.
+func SniffContentType(r io.ReadSeeker) (string, error) {
+	contentType := "application/octet-stream"
+	if _, format, err := image.DecodeConfig(r); err == nil {
+		if t, ok := ContentTypes[format]; ok {
+			contentType = t
+		}
+	} else {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+
+		head := make([]byte, 1024)
+		n, err := io.ReadFull(r, head)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+
+		switch {
+		case isPDF(head[:n]):
+			contentType = ContentTypes["pdf"]
+		case isSVG(head[:n]):
+			contentType = ContentTypes["svg"]
+		}
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return contentType, nil
+}
+
+// Encode writes the image in the given format. A nil opts uses the encoder
+// defaults.
+func Encode(w io.Writer, img image.Image, format string, opts *Output) error {
 	encoder, ok := Encoders[format]
 	if !ok {
 		return ErrUnsupportedFormat
 	}
 
-	if err := encoder(w, img); err != nil {
+	if opts == nil {
+		opts = &Output{}
+	}
+
+	if err := opts.validate(format); err != nil {
+		return err
+	}
+
+	if err := encoder(w, img, opts); err != nil {
 		return fmt.Errorf("failed to encode %s file: %w", format, err)
 	}
 
 	return nil
 }
 
-func toJpeg(w io.Writer, img image.Image) error {
-	return jpeg.Encode(w, img, nil)
+// toJpeg flattens transparent images onto white, as jpeg has no alpha and
+// transparent pixels, such as the default letterbox, would turn black.
+func toJpeg(w io.Writer, img image.Image, opts *Output) error {
+	var jpegOpts *jpeg.Options
+	if opts.Quality != 0 {
+		jpegOpts = &jpeg.Options{Quality: opts.Quality}
+	}
+
+	if hasAlpha(img) {
+		img = flatten(img, color.White)
+	}
+
+	return jpeg.Encode(w, img, jpegOpts)
+}
+
+// flatten draws the image over a background color.
+func flatten(img image.Image, background color.Color) image.Image {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Over)
+
+	return dst
+}
+
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"fast":    png.BestSpeed,
+	"best":    png.BestCompression,
 }
 
-func toPng(w io.Writer, img image.Image) error {
-	return png.Encode(w, img)
+func toPng(w io.Writer, img image.Image, opts *Output) error {
+	pngEncoder := &png.Encoder{
+		CompressionLevel: pngCompressionLevels[opts.Compression],
+	}
+
+	return pngEncoder.Encode(w, img)
+}
+
+func toWebp(w io.Writer, img image.Image, opts *Output) error {
+	var (
+		webpOpts *encoder.Options
+		err      error
+	)
+
+	switch {
+	case opts.Lossless:
+		webpOpts, err = encoder.NewLosslessEncoderOptions(encoder.PresetDefault, 6)
+	case opts.Quality != 0:
+		webpOpts, err = encoder.NewLossyEncoderOptions(encoder.PresetDefault, float32(opts.Quality))
+	}
+	if err != nil {
+		return err
+	}
+
+	return webp.Encode(w, img, webpOpts)
 }
 
-func toWebp(w io.Writer, img image.Image) error {
-	return webp.Encode(w, img, nil)
+func toAvif(w io.Writer, img image.Image, opts *Output) error {
+	avifOpts := avif.Options{
+		Quality:           avif.DefaultQuality,
+		QualityAlpha:      avif.DefaultQuality,
+		Speed:             avif.DefaultSpeed,
+		ChromaSubsampling: image.YCbCrSubsampleRatio420,
+	}
+
+	switch {
+	case opts.Lossless:
+		avifOpts.Quality, avifOpts.QualityAlpha = 100, 100
+		avifOpts.ChromaSubsampling = image.YCbCrSubsampleRatio444
+	case opts.Quality != 0:
+		avifOpts.Quality, avifOpts.QualityAlpha = opts.Quality, opts.Quality
+	}
+
+	return avif.Encode(w, img, avifOpts)
 }
 
-func toGif(w io.Writer, img image.Image) error {
-	return gif.Encode(w, img, nil)
+func toGif(w io.Writer, img image.Image, opts *Output) error {
+	gifOpts := &gif.Options{NumColors: 256}
+	if opts.Colors != 0 {
+		gifOpts.NumColors = opts.Colors
+	}
+
+	if opts.Dither != nil && !*opts.Dither {
+		gifOpts.Drawer = draw.Src
+	}
+
+	return gif.Encode(w, img, gifOpts)
 }
 
-func toBmp(w io.Writer, img image.Image) error {
+func toBmp(w io.Writer, img image.Image, _ *Output) error {
 	return bmp.Encode(w, img)
 }
 
-func toTiff(w io.Writer, img image.Image) error {
-	return tiff.Encode(w, img, nil)
+func toTiff(w io.Writer, img image.Image, opts *Output) error {
+	var tiffOpts *tiff.Options
+	switch opts.Compression {
+	case "deflate":
+		tiffOpts = &tiff.Options{Compression: tiff.Deflate, Predictor: true}
+	case "none":
+		tiffOpts = &tiff.Options{Compression: tiff.Uncompressed}
+	}
+
+	return tiff.Encode(w, img, tiffOpts)
 }
@@ -3,6 +3,7 @@ package imgproc_test
 import (
 	"bytes"
 	"image"
+	"image/png"
 	"testing"
 
 	"github.com/anthonynsimon/bild/imgio"
@@ -16,12 +17,15 @@ func TestImageTransformations(t *testing.T) {
 	}
 
 	t.Run("resize", func(t *testing.T) {
-		resizedImg := imgproc.Transform(img, &imgproc.Transformations{
+		resizedImg, err := imgproc.Transform(img, &imgproc.Transformations{
 			Resize: imgproc.Resize{
 				Width:  100,
 				Height: 100,
 			},
 		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
 
 		resizedBounds := resizedImg.Bounds()
 		if resizedBounds.Dx() != 100 || resizedBounds.Dy() != 100 {
@@ -34,7 +38,7 @@ func TestImageTransformations(t *testing.T) {
 	})
 
 	t.Run("crop", func(t *testing.T) {
-		croppedImg := imgproc.Transform(img, &imgproc.Transformations{
+		croppedImg, err := imgproc.Transform(img, &imgproc.Transformations{
 			Crop: imgproc.Crop{
 				Width:  100,
 				Height: 100,
@@ -42,6 +46,9 @@ func TestImageTransformations(t *testing.T) {
 				Y:      50,
 			},
 		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
 
 		croppedBounds := croppedImg.Bounds()
 		if croppedBounds.Dx() != 100 || croppedBounds.Dy() != 100 {
@@ -62,9 +69,12 @@ func TestImageTransformations(t *testing.T) {
 	})
 
 	t.Run("rotate", func(t *testing.T) {
-		rotatedImg := imgproc.Transform(img, &imgproc.Transformations{
+		rotatedImg, err := imgproc.Transform(img, &imgproc.Transformations{
 			Rotate: 90,
 		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
 
 		originalWidth := img.Bounds().Dy()
 		originalHeight := img.Bounds().Dx()
@@ -82,11 +92,14 @@ func TestImageTransformations(t *testing.T) {
 	})
 
 	t.Run("grayscale", func(t *testing.T) {
-		grayscaleImg := imgproc.Transform(img, &imgproc.Transformations{
+		grayscaleImg, err := imgproc.Transform(img, &imgproc.Transformations{
 			Filters: imgproc.Filters{
 				Grayscale: true,
 			},
 		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
 
 		if !isGrayscale(grayscaleImg) {
 			t.Error("expected image to be grayscale")
@@ -94,11 +107,14 @@ func TestImageTransformations(t *testing.T) {
 	})
 
 	t.Run("sepia", func(t *testing.T) {
-		sepiaImg := imgproc.Transform(img, &imgproc.Transformations{
+		sepiaImg, err := imgproc.Transform(img, &imgproc.Transformations{
 			Filters: imgproc.Filters{
 				Sepia: true,
 			},
 		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
 
 		if !isSepia(sepiaImg) {
 			t.Error("expected image to be sepia")
@@ -173,7 +189,7 @@ func TestImageEncoding(t *testing.T) {
 			want := format
 
 			imgBuff := new(bytes.Buffer)
-			if err := imgproc.Encode(imgBuff, img, format); err != nil {
+			if err := imgproc.Encode(imgBuff, img, format, nil); err != nil {
 				t.Errorf("failed to encode image to %s: %v", format, err)
 			}
 
@@ -190,7 +206,7 @@ func TestImageEncoding(t *testing.T) {
 
 	t.Run("unsupported format", func(t *testing.T) {
 		imgBuff := new(bytes.Buffer)
-		err := imgproc.Encode(imgBuff, img, "unsupported")
+		err := imgproc.Encode(imgBuff, img, "unsupported", nil)
 		if err == nil {
 			t.Error("expected to fail encoding image to unsupported format")
 		}
@@ -199,3 +215,38 @@ func TestImageEncoding(t *testing.T) {
 		}
 	})
 }
+
+func TestSniffContentType(t *testing.T) {
+	pngData := new(bytes.Buffer)
+	if err := png.Encode(pngData, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+
+	testCases := map[string]struct {
+		data []byte
+		want string
+	}{
+		"png":     {pngData.Bytes(), "image/png"},
+		"svg":     {[]byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"/>`), "image/svg+xml"},
+		"pdf":     {samplePDF(t), "application/pdf"},
+		"unknown": {[]byte("plain text"), "application/octet-stream"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := bytes.NewReader(tc.data)
+			got, err := imgproc.SniffContentType(r)
+			if err != nil {
+				t.Fatalf("failed to sniff content type: %v", err)
+			}
+
+			if got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+
+			if r.Len() != len(tc.data) {
+				t.Errorf("expected the reader to be rewound, %d bytes left", r.Len())
+			}
+		})
+	}
+}
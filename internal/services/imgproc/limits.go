@@ -0,0 +1,247 @@
+package imgproc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+)
+
+// Limits bound the size of the images decoded and produced for a user,
+// protecting the workers from decompression bombs. Zero fields are
+// unlimited.
+type Limits struct {
+	MaxPixels int
+	MaxWidth  int
+	MaxHeight int
+	// MaxFrames bounds the frames of animations.
+	MaxFrames int
+	// MaxTotalPixels bounds the pixels of all the frames together, the
+	// canvas size times the frames. Animations of tiny frames on a large
+	// canvas are as large once decoded.
+	MaxTotalPixels int
+}
+
+const (
+	TierFree = "free"
+	TierPro  = "pro"
+)
+
+// TierLimits maps user tiers to their limits. Tiers without limits, and the
+// zero TierLimits, are unlimited.
+type TierLimits map[string]Limits
+
+// For returns the limits of the tier, falling back to the free tier for
+// unknown ones.
+func (tl TierLimits) For(tier string) Limits {
+	if limits, ok := tl[tier]; ok {
+		return limits
+	}
+
+	return tl[TierFree]
+}
+
+var ErrLimitExceeded = errors.New("image exceeds the size limits")
+
+func (l Limits) check(width, height, frames int) error {
+	switch {
+	case l.MaxWidth > 0 && width > l.MaxWidth:
+		return fmt.Errorf("%w: width %d is over %d", ErrLimitExceeded, width, l.MaxWidth)
+	case l.MaxHeight > 0 && height > l.MaxHeight:
+		return fmt.Errorf("%w: height %d is over %d", ErrLimitExceeded, height, l.MaxHeight)
+	case l.MaxPixels > 0 && width*height > l.MaxPixels:
+		return fmt.Errorf("%w: %d pixels is over %d", ErrLimitExceeded, width*height, l.MaxPixels)
+	case l.MaxFrames > 0 && frames > l.MaxFrames:
+		return fmt.Errorf("%w: %d frames is over %d", ErrLimitExceeded, frames, l.MaxFrames)
+	case l.MaxTotalPixels > 0 && width*height*frames > l.MaxTotalPixels:
+		return fmt.Errorf("%w: %d pixels over all frames is over %d",
+			ErrLimitExceeded, width*height*frames, l.MaxTotalPixels)
+	}
+
+	return nil
+}
+
+// fit returns the scale, at most 1, that fits a width x height image within
+// the limits.
+func (l Limits) fit(width, height float64) float64 {
+	scale := 1.0
+	if l.MaxWidth > 0 {
+		scale = math.Min(scale, float64(l.MaxWidth)/width)
+	}
+	if l.MaxHeight > 0 {
+		scale = math.Min(scale, float64(l.MaxHeight)/height)
+	}
+	if l.MaxPixels > 0 {
+		scale = math.Min(scale, math.Sqrt(float64(l.MaxPixels)/(width*height)))
+	}
+
+	return scale
+}
+
+// checkData checks the size declared in the header of raster images before
+// they are decoded. Data that can't be read this way, such as svgs and pdfs,
+// is left to the decoders, which render it at a size fitting the limits.
+func (l Limits) checkData(r io.ReadSeeker) error {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil
+	}
+
+	frames := 1
+	if format == "gif" {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read gif: %w", err)
+		}
+
+		frames = gifFrames(r)
+	}
+
+	return l.check(config.Width, config.Height, frames)
+}
+
+// checkPipeline checks the size of every image the pipeline produces from a
+// width x height image, before running it.
+func (l Limits) checkPipeline(t *Transformations, width, height int) error {
+	for _, step := range t.pipeline() {
+		switch params := step.params().(type) {
+		case *Resize:
+			var peakW, peakH int
+			peakW, peakH, width, height = resizedSize(width, height, params)
+			if err := l.check(peakW, peakH, 1); err != nil {
+				return err
+			}
+		case *Crop:
+			if params.Width > 0 && params.Height > 0 {
+				width, height = min(width, params.Width), min(height, params.Height)
+			}
+		case *Rotate:
+			// Angles other than right ones are supersampled at twice the
+			// size, the result keeps the size of the source.
+			if int(math.Abs(params.Angle)+0.5)%90 != 0 {
+				if err := l.check(width*2, height*2, 1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// resizedSize mirrors resize, returning the size of the largest image it
+// allocates and the size of the result.
+func resizedSize(srcW, srcH int, r *Resize) (peakW, peakH, width, height int) {
+	if (r.Width <= 0 && r.Height <= 0) || srcW == 0 || srcH == 0 {
+		return srcW, srcH, srcW, srcH
+	}
+
+	scaled := func(scale float64) (int, int) {
+		return max(1, int(math.Round(float64(srcW)*scale))),
+			max(1, int(math.Round(float64(srcH)*scale)))
+	}
+
+	scaleX := float64(r.Width) / float64(srcW)
+	scaleY := float64(r.Height) / float64(srcH)
+	if r.Width <= 0 || r.Height <= 0 {
+		width, height = scaled(max(scaleX, scaleY))
+		return width, height, width, height
+	}
+
+	switch r.Fit {
+	case FitCover:
+		peakW, peakH = scaled(max(scaleX, scaleY))
+		return peakW, peakH, r.Width, r.Height
+	case FitInside:
+		width, height = scaled(min(scaleX, scaleY))
+	case FitOutside:
+		width, height = scaled(max(scaleX, scaleY))
+	default:
+		width, height = r.Width, r.Height
+	}
+
+	return width, height, width, height
+}
+
+// gifFrames counts the frames of a gif by walking its blocks, without
+// decoding them. Malformed gifs return the frames found so far.
+func gifFrames(r io.Reader) int {
+	const (
+		extension       = 0x21
+		imageDescriptor = 0x2c
+		// headerSize is the size of the header and the logical screen
+		// descriptor.
+		headerSize = 13
+	)
+
+	br := bufio.NewReader(r)
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0
+	}
+
+	if _, err := br.Discard(colorTableSize(header[10])); err != nil {
+		return 0
+	}
+
+	frames := 0
+	descriptor := make([]byte, 9)
+	for {
+		block, err := br.ReadByte()
+		if err != nil {
+			return frames
+		}
+
+		switch block {
+		case extension:
+			if _, err := br.ReadByte(); err != nil {
+				return frames
+			}
+		case imageDescriptor:
+			frames++
+			if _, err := io.ReadFull(br, descriptor); err != nil {
+				return frames
+			}
+
+			// The LZW minimum code size precedes the image data.
+			if _, err := br.Discard(colorTableSize(descriptor[8]) + 1); err != nil {
+				return frames
+			}
+		default:
+			// The trailer, or garbage.
+			return frames
+		}
+
+		if err := skipSubBlocks(br); err != nil {
+			return frames
+		}
+	}
+}
+
+// colorTableSize returns the size of the color table described by the
+// packed fields of a gif descriptor.
+func colorTableSize(flags byte) int {
+	if flags&0x80 == 0 {
+		return 0
+	}
+
+	return 3 << (flags&0x07 + 1)
+}
+
+func skipSubBlocks(br *bufio.Reader) error {
+	for {
+		size, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if size == 0 {
+			return nil
+		}
+
+		if _, err := br.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+)
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := user.NewMemoryRepo()
+	imgRepo := img.NewMemoryRepo()
+	contentStore := storage.NewContentStore(storage.NewFSImageStorage("test_data", ""), blob.NewMemoryRepo())
+
+	free, _ := userRepo.Create(ctx, models.User{
+		Username:     "free",
+		PasswordHash: "test",
+	})
+	pro, _ := userRepo.Create(ctx, models.User{
+		Username:     "pro",
+		PasswordHash: "test",
+		Tier:         imgproc.TierPro,
+	})
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./test_data/blobs")
+	})
+
+	limits := imgproc.TierLimits{
+		imgproc.TierFree: {MaxPixels: 1_000_000, MaxWidth: 1500, MaxHeight: 1500, MaxFrames: 2},
+		imgproc.TierPro:  {MaxFrames: 10},
+	}
+	upload := imgproc.NewUpload(userRepo, imgRepo, contentStore, limits)
+
+	t.Run("rejects decompression bombs", func(t *testing.T) {
+		_, err := upload.Do(ctx, free.ID, pngBomb(t, 50000, 50000), &imgproc.ImageMetadata{
+			Filename: "bomb.png",
+			Format:   "png",
+		})
+		if !errors.Is(err, imgproc.ErrLimitExceeded) {
+			t.Errorf("expected ErrLimitExceeded, got %v", err)
+		}
+	})
+
+	t.Run("limits frames per tier", func(t *testing.T) {
+		metadata := &imgproc.ImageMetadata{
+			Filename: "animated.gif",
+			Format:   "gif",
+		}
+
+		_, err := upload.Do(ctx, free.ID, animatedGif(t), metadata)
+		if !errors.Is(err, imgproc.ErrLimitExceeded) {
+			t.Errorf("expected ErrLimitExceeded, got %v", err)
+		}
+
+		if _, err := upload.Do(ctx, pro.ID, animatedGif(t), metadata); err != nil {
+			t.Errorf("expected the pro tier to accept 3 frames, got %v", err)
+		}
+	})
+
+	t.Run("limits the pixels of all frames", func(t *testing.T) {
+		// Every frame and the canvas are within the default free tier
+		// limits, but decoding all frames takes 2.5 billion pixels.
+		upload := imgproc.NewUpload(userRepo, imgRepo, contentStore, imgproc.TierLimits{
+			imgproc.TierFree: {
+				MaxPixels:      25_000_000,
+				MaxWidth:       8192,
+				MaxHeight:      8192,
+				MaxFrames:      100,
+				MaxTotalPixels: 100_000_000,
+			},
+		})
+
+		_, err := upload.Do(ctx, free.ID, gifBomb(t, 5000, 5000, 100), &imgproc.ImageMetadata{
+			Filename: "bomb.gif",
+			Format:   "gif",
+		})
+		if !errors.Is(err, imgproc.ErrLimitExceeded) {
+			t.Errorf("expected ErrLimitExceeded, got %v", err)
+		}
+	})
+
+	t.Run("limits resizes", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+			t.Fatalf("failed to encode png: %v", err)
+		}
+
+		_, err := upload.Do(ctx, free.ID, buf.Bytes(), &imgproc.ImageMetadata{
+			Filename: "small.png",
+			Format:   "png",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		sut := imgproc.NewDelivery(userRepo, imgRepo, contentStore, limits, false)
+		tests := map[string]imgproc.Resize{
+			"width":  {Width: 2000},
+			"pixels": {Width: 1200, Height: 1200},
+			// Covering 1000x1000 scales the image to 2000x1000 first.
+			"cover": {Width: 1000, Height: 1000, Fit: imgproc.FitCover},
+		}
+
+		for name, resize := range tests {
+			t.Run(name, func(t *testing.T) {
+				_, _, err := sut.Do(ctx, free.ID, "small.png", &imgproc.Transformations{
+					Resize: resize,
+				}, "")
+				if !errors.Is(err, imgproc.ErrLimitExceeded) {
+					t.Errorf("expected ErrLimitExceeded, got %v", err)
+				}
+			})
+		}
+
+		_, _, err = sut.Do(ctx, free.ID, "small.png", &imgproc.Transformations{
+			Resize: imgproc.Resize{Width: 1000, Height: 1000, Fit: imgproc.FitContain},
+		}, "")
+		if err != nil {
+			t.Errorf("expected a resize within the limits, got %v", err)
+		}
+	})
+
+	t.Run("renders svgs within the limits", func(t *testing.T) {
+		svg := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 8000 4000"><rect width="8000" height="4000" fill="#ff0000"/></svg>`
+		_, err := upload.Do(ctx, free.ID, []byte(svg), &imgproc.ImageMetadata{
+			Filename: "large.svg",
+			Format:   "svg",
+		})
+		if err != nil {
+			t.Fatalf("could not upload svg: %v", err)
+		}
+
+		sut := imgproc.NewDelivery(userRepo, imgRepo, contentStore, limits, false)
+		imgData, _, err := sut.Do(ctx, free.ID, "large.svg", &imgproc.Transformations{Format: "png"}, "")
+		if err != nil {
+			t.Fatalf("could not deliver svg: %v", err)
+		}
+
+		config, err := png.DecodeConfig(bytes.NewReader(imgData))
+		if err != nil {
+			t.Fatalf("failed to decode png: %v", err)
+		}
+
+		if config.Width > 1500 || config.Width*config.Height > 1_000_000 {
+			t.Errorf("expected the svg to be rendered within the limits, got %dx%d", config.Width, config.Height)
+		}
+	})
+
+	t.Run("limits rotations", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 800, 800))); err != nil {
+			t.Fatalf("failed to encode png: %v", err)
+		}
+
+		_, err := upload.Do(ctx, free.ID, buf.Bytes(), &imgproc.ImageMetadata{
+			Filename: "square.png",
+			Format:   "png",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		// Rotating by 45 degrees supersamples the image at 1600x1600.
+		sut := imgproc.NewDelivery(userRepo, imgRepo, contentStore, limits, false)
+		_, _, err = sut.Do(ctx, free.ID, "square.png", &imgproc.Transformations{Rotate: 45, Format: "png"}, "")
+		if !errors.Is(err, imgproc.ErrLimitExceeded) {
+			t.Errorf("expected ErrLimitExceeded, got %v", err)
+		}
+
+		_, _, err = sut.Do(ctx, free.ID, "square.png", &imgproc.Transformations{Rotate: 90, Format: "png"}, "")
+		if err != nil {
+			t.Errorf("expected a right angle rotation within the limits, got %v", err)
+		}
+	})
+}
+
+// pngBomb returns a 1x1 png whose header declares the given size.
+func pngBomb(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+
+	// The IHDR chunk follows the 8 bytes signature: length, type, width,
+	// height, the rest of the header and the checksum of type and data.
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	return data
+}
+
+// gifBomb encodes an animation of 1x1 frames on a large canvas, tiny on disk
+// but a full canvas for every frame once composited.
+func gifBomb(t *testing.T, width, height, frames int) []byte {
+	t.Helper()
+
+	g := &gif.GIF{
+		Config: image.Config{
+			ColorModel: color.Palette(palette.Plan9),
+			Width:      width,
+			Height:     height,
+		},
+	}
+	for range frames {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), palette.Plan9))
+		g.Delay = append(g.Delay, 10)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, g); err != nil {
+		t.Fatalf("failed to encode gif: %v", err)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,72 @@
+package imgproc
+
+import (
+	"image"
+	"strconv"
+	"strings"
+)
+
+// FormatAuto lets the server pick the output format from the client's
+// Accept header, see NegotiateFormat.
+const FormatAuto = "auto"
+
+// negotiableFormats are the formats picked by NegotiateFormat when the
+// client explicitly accepts them, in order of preference.
+var negotiableFormats = []string{"avif", "webp"}
+
+// NegotiateFormat picks the best output format for an HTTP Accept header.
+// Modern formats are only used when explicitly accepted, otherwise it falls
+// back to png for images with transparency and jpeg for everything else.
+func NegotiateFormat(accept string, img image.Image) string {
+	accepted := acceptedTypes(accept)
+	for _, format := range negotiableFormats {
+		if q, ok := accepted[ContentTypes[format]]; ok && q > 0 {
+			return format
+		}
+	}
+
+	if hasAlpha(img) {
+		return "png"
+	}
+
+	return "jpeg"
+}
+
+// acceptedTypes parses an Accept header into media types and their quality.
+func acceptedTypes(accept string) map[string]float64 {
+	accepted := map[string]float64{}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && key == "q" {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		accepted[strings.ToLower(strings.TrimSpace(mediaType))] = q
+	}
+
+	return accepted
+}
+
+func hasAlpha(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+
+	return false
+}
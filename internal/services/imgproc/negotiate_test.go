@@ -0,0 +1,42 @@
+package imgproc_test
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/services/imgproc"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	opaque := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for x := range 2 {
+		for y := range 2 {
+			opaque.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	transparent := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	testCases := []struct {
+		name   string
+		accept string
+		img    image.Image
+		want   string
+	}{
+		{"avif preferred", "image/avif,image/webp,image/apng,*/*;q=0.8", opaque, "avif"},
+		{"webp accepted", "image/webp,image/apng,*/*;q=0.8", opaque, "webp"},
+		{"webp rejected", "image/webp;q=0, */*", opaque, "jpeg"},
+		{"wildcard opaque", "*/*", opaque, "jpeg"},
+		{"wildcard transparent", "image/*", transparent, "png"},
+		{"no header", "", transparent, "png"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := imgproc.NegotiateFormat(tc.accept, tc.img); got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
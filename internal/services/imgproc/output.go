@@ -0,0 +1,114 @@
+package imgproc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Output holds the encoder options. Each option only applies to some
+// formats, setting it for any other format is an error.
+type Output struct {
+	// Quality is used by jpeg, lossy webp and lossy avif, from 1 to 100.
+	Quality int `json:"quality" validate:"omitempty,min=1,max=100"`
+	// Lossless switches webp and avif to lossless encoding.
+	Lossless bool `json:"lossless"`
+	// Compression is default, none, fast or best for png and none or
+	// deflate for tiff.
+	Compression string `json:"compression" validate:"omitempty,oneof=default none fast best deflate"`
+	// Colors is the gif palette size, from 2 to 256.
+	Colors int `json:"colors" validate:"omitempty,min=2,max=256"`
+	// Dither toggles Floyd-Steinberg dithering for gif, enabled by default.
+	Dither *bool `json:"dither"`
+	// Metadata is strip (default), keep or keep_icc. The EXIF data and ICC
+	// profile of jpeg originals can only be kept on jpeg output.
+	Metadata string `json:"metadata" validate:"omitempty,oneof=strip keep keep_icc"`
+	// Progressive is not supported yet, the jpeg and png encoders only
+	// write baseline and non-interlaced images. It is rejected instead of
+	// being silently ignored.
+	Progressive bool `json:"progressive"`
+}
+
+var ErrInvalidOutput = errors.New("invalid output options")
+
+var errProgressive = fmt.Errorf("%w: progressive encoding is not supported", ErrInvalidOutput)
+
+var (
+	qualityFormats  = []string{"jpeg", "jpg", "webp", "avif"}
+	losslessFormats = []string{"webp", "avif"}
+)
+
+var metadataFormats = []string{"jpeg", "jpg"}
+
+var compressionLevels = map[string][]string{
+	"png":  {"default", "none", "fast", "best"},
+	"tiff": {"none", "deflate"},
+	"tif":  {"none", "deflate"},
+}
+
+func (o *Output) validate(format string) error {
+	switch {
+	case o.Progressive:
+		return errProgressive
+	case o.Quality != 0 && !slices.Contains(qualityFormats, format):
+		return fmt.Errorf("%w: quality is not supported for %s", ErrInvalidOutput, format)
+	case o.Quality != 0 && o.Lossless:
+		return fmt.Errorf("%w: quality can not be combined with lossless", ErrInvalidOutput)
+	case o.Lossless && !slices.Contains(losslessFormats, format):
+		return fmt.Errorf("%w: lossless is not supported for %s", ErrInvalidOutput, format)
+	case o.Compression != "" && !slices.Contains(compressionLevels[format], o.Compression):
+		return fmt.Errorf("%w: compression %q is not supported for %s", ErrInvalidOutput, o.Compression, format)
+	case (o.Colors != 0 || o.Dither != nil) && format != "gif":
+		return fmt.Errorf("%w: colors and dither are not supported for %s", ErrInvalidOutput, format)
+	case o.Metadata != "" && o.Metadata != MetadataStrip && !slices.Contains(metadataFormats, format):
+		return fmt.Errorf("%w: metadata %q is not supported for %s", ErrInvalidOutput, o.Metadata, format)
+	}
+
+	return nil
+}
+
+// forFormat drops the options the format does not support. It is used for
+// negotiated formats, where the client can not know the final format.
+func (o Output) forFormat(format string) Output {
+	if !slices.Contains(qualityFormats, format) || o.Lossless {
+		o.Quality = 0
+	}
+
+	if !slices.Contains(losslessFormats, format) {
+		o.Lossless = false
+	}
+
+	if !slices.Contains(compressionLevels[format], o.Compression) {
+		o.Compression = ""
+	}
+
+	if format != "gif" {
+		o.Colors = 0
+		o.Dither = nil
+	}
+
+	if !slices.Contains(metadataFormats, format) {
+		o.Metadata = ""
+	}
+
+	return o
+}
+
+// Validate reports whether the output format is supported and the output
+// options apply to it.
+func (t *Transformations) Validate() error {
+	if t.Output.Progressive {
+		return errProgressive
+	}
+
+	if t.Format == FormatAuto {
+		// Options that do not apply to the negotiated format are dropped.
+		return nil
+	}
+
+	if _, ok := Encoders[t.Format]; !ok {
+		return ErrUnsupportedFormat
+	}
+
+	return t.Output.validate(t.Format)
+}
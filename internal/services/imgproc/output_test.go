@@ -0,0 +1,125 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"testing"
+
+	"github.com/anthonynsimon/bild/imgio"
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+)
+
+func TestEncodeOutputOptions(t *testing.T) {
+	img, err := imgio.Open("./test_data/flowers.jpg")
+	if err != nil {
+		t.Fatalf("failed to open image file: %v", err)
+	}
+	img = transform.Resize(img, 300, 200, transform.Linear)
+
+	encodedSize := func(t *testing.T, format string, opts *imgproc.Output) int {
+		t.Helper()
+
+		imgBuff := new(bytes.Buffer)
+		if err := imgproc.Encode(imgBuff, img, format, opts); err != nil {
+			t.Fatalf("failed to encode image to %s: %v", format, err)
+		}
+
+		return imgBuff.Len()
+	}
+
+	t.Run("jpeg quality", func(t *testing.T) {
+		low := encodedSize(t, "jpeg", &imgproc.Output{Quality: 10})
+		high := encodedSize(t, "jpeg", &imgproc.Output{Quality: 95})
+		if low >= high {
+			t.Errorf("expected quality 10 (%d bytes) to be smaller than quality 95 (%d bytes)", low, high)
+		}
+	})
+
+	t.Run("avif quality", func(t *testing.T) {
+		low := encodedSize(t, "avif", &imgproc.Output{Quality: 10})
+		high := encodedSize(t, "avif", &imgproc.Output{Quality: 90})
+		if low >= high {
+			t.Errorf("expected quality 10 (%d bytes) to be smaller than quality 90 (%d bytes)", low, high)
+		}
+
+		imgBuff := new(bytes.Buffer)
+		if err := imgproc.Encode(imgBuff, img, "avif", &imgproc.Output{Lossless: true}); err != nil {
+			t.Fatalf("failed to encode lossless avif: %v", err)
+		}
+
+		_, format, err := image.Decode(imgBuff)
+		if err != nil || format != "avif" {
+			t.Errorf("expected an avif image, got %q: %v", format, err)
+		}
+	})
+
+	t.Run("png compression", func(t *testing.T) {
+		none := encodedSize(t, "png", &imgproc.Output{Compression: "none"})
+		best := encodedSize(t, "png", &imgproc.Output{Compression: "best"})
+		if best >= none {
+			t.Errorf("expected best compression (%d bytes) to be smaller than none (%d bytes)", best, none)
+		}
+	})
+
+	t.Run("tiff compression", func(t *testing.T) {
+		none := encodedSize(t, "tiff", &imgproc.Output{Compression: "none"})
+		deflate := encodedSize(t, "tiff", &imgproc.Output{Compression: "deflate"})
+		if deflate >= none {
+			t.Errorf("expected deflate (%d bytes) to be smaller than none (%d bytes)", deflate, none)
+		}
+	})
+
+	t.Run("gif colors", func(t *testing.T) {
+		dither := false
+		imgBuff := new(bytes.Buffer)
+		err := imgproc.Encode(imgBuff, img, "gif", &imgproc.Output{Colors: 16, Dither: &dither})
+		if err != nil {
+			t.Fatalf("failed to encode image to gif: %v", err)
+		}
+
+		decoded, err := gif.Decode(imgBuff)
+		if err != nil {
+			t.Fatalf("failed to decode gif: %v", err)
+		}
+
+		if n := len(decoded.(*image.Paletted).Palette); n > 16 {
+			t.Errorf("expected at most 16 colors, got %d", n)
+		}
+	})
+
+	invalid := []struct {
+		name   string
+		format string
+		opts   imgproc.Output
+	}{
+		{"png quality", "png", imgproc.Output{Quality: 80}},
+		{"jpeg lossless", "jpeg", imgproc.Output{Lossless: true}},
+		{"webp quality and lossless", "webp", imgproc.Output{Quality: 80, Lossless: true}},
+		{"tiff fast compression", "tiff", imgproc.Output{Compression: "fast"}},
+		{"png colors", "png", imgproc.Output{Colors: 16}},
+		{"jpeg progressive", "jpeg", imgproc.Output{Progressive: true}},
+	}
+
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			err := imgproc.Encode(new(bytes.Buffer), img, tc.format, &tc.opts)
+			if !errors.Is(err, imgproc.ErrInvalidOutput) {
+				t.Errorf("expected ErrInvalidOutput, got %v", err)
+			}
+		})
+	}
+
+	t.Run("progressive with negotiated format", func(t *testing.T) {
+		tr := &imgproc.Transformations{
+			Format: imgproc.FormatAuto,
+			Output: imgproc.Output{Progressive: true},
+		}
+
+		if err := tr.Validate(); !errors.Is(err, imgproc.ErrInvalidOutput) {
+			t.Errorf("expected ErrInvalidOutput, got %v", err)
+		}
+	})
+}
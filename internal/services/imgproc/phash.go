@@ -0,0 +1,32 @@
+package imgproc
+
+import (
+	"image"
+
+	"github.com/anthonynsimon/bild/transform"
+)
+
+// DHash computes the difference hash of the image. The image is shrunk to
+// 9x8 gray pixels and each bit tells whether a pixel is brighter than its
+// right neighbour, so resized or recompressed copies of an image get the
+// same or a close hash.
+func DHash(img image.Image) int64 {
+	sample := transform.Resize(img, 9, 8, transform.Box)
+
+	var hash uint64
+	for y := range 8 {
+		for x := range 8 {
+			hash <<= 1
+			if luma(sample, x, y) > luma(sample, x+1, y) {
+				hash |= 1
+			}
+		}
+	}
+
+	return int64(hash)
+}
+
+func luma(img *image.RGBA, x, y int) float64 {
+	p := img.Pix[img.PixOffset(x, y):]
+	return 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+}
@@ -0,0 +1,38 @@
+package imgproc_test
+
+import (
+	"math/bits"
+	"testing"
+
+	"github.com/anthonynsimon/bild/effect"
+	"github.com/anthonynsimon/bild/imgio"
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+)
+
+func TestDHash(t *testing.T) {
+	img, err := imgio.Open("./test_data/flowers.jpg")
+	if err != nil {
+		t.Fatalf("failed to open image file: %v", err)
+	}
+	img = transform.Resize(img, 600, 400, transform.Linear)
+
+	hash := imgproc.DHash(img)
+	distance := func(a, b int64) int {
+		return bits.OnesCount64(uint64(a ^ b))
+	}
+
+	t.Run("resized copy", func(t *testing.T) {
+		resized := transform.Resize(img, 150, 100, transform.Lanczos)
+		if d := distance(hash, imgproc.DHash(resized)); d > imgproc.DuplicateDistance {
+			t.Errorf("expected a resized copy to be a duplicate, got distance %d", d)
+		}
+	})
+
+	t.Run("different image", func(t *testing.T) {
+		different := effect.Invert(img)
+		if d := distance(hash, imgproc.DHash(different)); d <= imgproc.DuplicateDistance {
+			t.Errorf("expected a different image not to be a duplicate, got distance %d", d)
+		}
+	})
+}
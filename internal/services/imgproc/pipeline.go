@@ -0,0 +1,140 @@
+package imgproc
+
+import (
+	"encoding/json"
+	"image"
+)
+
+const (
+	OpResize    = "resize"
+	OpCrop      = "crop"
+	OpRotate    = "rotate"
+	OpFilters   = "filters"
+	OpWatermark = "watermark"
+)
+
+// Step is a single operation of an ordered transformation pipeline. It is
+// encoded as a tagged union where "op" selects the operation and the
+// remaining fields are its parameters, e.g.
+//
+//	{"op": "crop", "width": 100, "height": 100, "x": 10, "y": 10}
+//	{"op": "resize", "width": 50, "height": 50}
+//	{"op": "rotate", "angle": 90}
+//	{"op": "filters", "grayscale": true}
+//	{"op": "watermark", "text": "imago", "gravity": "south-east"}
+type Step struct {
+	Op        string     `json:"op" validate:"required,oneof=resize crop rotate filters watermark"`
+	Resize    *Resize    `json:"-" validate:"required_if=Op resize"`
+	Crop      *Crop      `json:"-" validate:"required_if=Op crop"`
+	Rotate    *Rotate    `json:"-" validate:"required_if=Op rotate"`
+	Filters   *Filters   `json:"-" validate:"required_if=Op filters"`
+	Watermark *Watermark `json:"-" validate:"required_if=Op watermark"`
+}
+
+type Rotate struct {
+	Angle float64 `json:"angle"`
+}
+
+func (s *Step) UnmarshalJSON(data []byte) error {
+	var tag struct {
+		Op string `json:"op"`
+	}
+	if err := json.Unmarshal(data, &tag); err != nil {
+		return err
+	}
+
+	*s = Step{Op: tag.Op}
+	switch s.Op {
+	case OpResize:
+		s.Resize = &Resize{}
+	case OpCrop:
+		s.Crop = &Crop{}
+	case OpRotate:
+		s.Rotate = &Rotate{}
+	case OpFilters:
+		s.Filters = &Filters{}
+	case OpWatermark:
+		s.Watermark = &Watermark{}
+	}
+
+	params := s.params()
+	if params == nil {
+		// Unknown operations are reported by validation.
+		return nil
+	}
+
+	return json.Unmarshal(data, params)
+}
+
+func (s Step) MarshalJSON() ([]byte, error) {
+	fields := map[string]any{}
+	if params := s.params(); params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+	}
+
+	fields["op"] = s.Op
+	return json.Marshal(fields)
+}
+
+func (s *Step) params() any {
+	switch {
+	case s.Op == OpResize && s.Resize != nil:
+		return s.Resize
+	case s.Op == OpCrop && s.Crop != nil:
+		return s.Crop
+	case s.Op == OpRotate && s.Rotate != nil:
+		return s.Rotate
+	case s.Op == OpFilters && s.Filters != nil:
+		return s.Filters
+	case s.Op == OpWatermark && s.Watermark != nil:
+		return s.Watermark
+	}
+
+	return nil
+}
+
+func (s *Step) apply(img image.Image, pins anchors) (image.Image, error) {
+	switch params := s.params().(type) {
+	case *Resize:
+		return resize(img, params, pins), nil
+	case *Crop:
+		return crop(img, params, pins), nil
+	case *Rotate:
+		return rotate(img, params.Angle), nil
+	case *Filters:
+		return applyFilters(img, params), nil
+	case *Watermark:
+		return watermark(img, params)
+	}
+
+	return img, nil
+}
+
+// pipeline returns the steps to run. Requests without explicit steps run
+// the flat fields in the fixed order: resize, crop, rotate, filters and
+// watermark.
+func (t *Transformations) pipeline() []Step {
+	if len(t.Steps) > 0 {
+		return t.Steps
+	}
+
+	steps := []Step{
+		{Op: OpResize, Resize: &t.Resize},
+		{Op: OpCrop, Crop: &t.Crop},
+		{Op: OpRotate, Rotate: &Rotate{Angle: t.Rotate}},
+		{Op: OpFilters, Filters: &t.Filters},
+	}
+
+	if t.Watermark != nil {
+		steps = append(steps, Step{Op: OpWatermark, Watermark: t.Watermark})
+	}
+
+	return steps
+}
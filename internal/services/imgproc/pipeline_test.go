@@ -0,0 +1,126 @@
+package imgproc_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/anthonynsimon/bild/imgio"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestPipeline(t *testing.T) {
+	img, err := imgio.Open("./test_data/flowers.jpg")
+	if err != nil {
+		t.Fatalf("failed to open image file: %v", err)
+	}
+
+	t.Run("crop then resize", func(t *testing.T) {
+		got, err := imgproc.Transform(img, &imgproc.Transformations{
+			Steps: []imgproc.Step{
+				{Op: imgproc.OpCrop, Crop: &imgproc.Crop{Width: 200, Height: 100}},
+				{Op: imgproc.OpResize, Resize: &imgproc.Resize{Width: 50, Height: 50}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		if got.Bounds().Dx() != 50 || got.Bounds().Dy() != 50 {
+			t.Errorf("expected image to be 50x50, got %dx%d", got.Bounds().Dx(), got.Bounds().Dy())
+		}
+	})
+
+	t.Run("resize then crop", func(t *testing.T) {
+		got, err := imgproc.Transform(img, &imgproc.Transformations{
+			Steps: []imgproc.Step{
+				{Op: imgproc.OpResize, Resize: &imgproc.Resize{Width: 300, Height: 300}},
+				{Op: imgproc.OpCrop, Crop: &imgproc.Crop{Width: 200, Height: 100}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		if got.Bounds().Dx() != 200 || got.Bounds().Dy() != 100 {
+			t.Errorf("expected image to be 200x100, got %dx%d", got.Bounds().Dx(), got.Bounds().Dy())
+		}
+	})
+}
+
+func TestStepJSON(t *testing.T) {
+	data := []byte(`{
+		"format": "png",
+		"steps": [
+			{"op": "crop", "width": 100, "height": 80, "x": 5, "y": 10},
+			{"op": "rotate", "angle": 90},
+			{"op": "filters", "grayscale": true}
+		]
+	}`)
+
+	var got imgproc.Transformations
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to unmarshal transformations: %v", err)
+	}
+
+	if len(got.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(got.Steps))
+	}
+
+	want := imgproc.Crop{Width: 100, Height: 80, X: 5, Y: 10}
+	if got.Steps[0].Crop == nil || *got.Steps[0].Crop != want {
+		t.Errorf("expected crop step to be %+v, got %+v", want, got.Steps[0].Crop)
+	}
+
+	if got.Steps[1].Rotate == nil || got.Steps[1].Rotate.Angle != 90 {
+		t.Errorf("expected rotate step with angle 90, got %+v", got.Steps[1].Rotate)
+	}
+
+	encoded, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("failed to marshal transformations: %v", err)
+	}
+
+	var roundTrip imgproc.Transformations
+	if err := json.Unmarshal(encoded, &roundTrip); err != nil {
+		t.Fatalf("failed to unmarshal encoded transformations: %v", err)
+	}
+
+	if roundTrip.Steps[2].Filters == nil || !roundTrip.Steps[2].Filters.Grayscale {
+		t.Errorf("expected filters step to survive round trip, got %s", encoded)
+	}
+}
+
+func TestStepValidation(t *testing.T) {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	t.Run("valid", func(t *testing.T) {
+		var tr imgproc.Transformations
+		data := `{"format": "png", "steps": [{"op": "crop", "width": 10, "height": 10}, {"op": "rotate", "angle": 45}]}`
+		if err := json.Unmarshal([]byte(data), &tr); err != nil {
+			t.Fatalf("failed to unmarshal transformations: %v", err)
+		}
+
+		if err := validate.Struct(tr); err != nil {
+			t.Errorf("expected steps to be valid, got %v", err)
+		}
+	})
+
+	testCases := map[string]string{
+		"unknown op":     `{"format": "png", "steps": [{"op": "explode"}]}`,
+		"negative width": `{"format": "png", "steps": [{"op": "resize", "width": -1}]}`,
+	}
+
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var tr imgproc.Transformations
+			if err := json.Unmarshal([]byte(data), &tr); err != nil {
+				t.Fatalf("failed to unmarshal transformations: %v", err)
+			}
+
+			if err := validate.Struct(tr); err == nil {
+				t.Error("expected validation to fail")
+			}
+		})
+	}
+}
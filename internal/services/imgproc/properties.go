@@ -0,0 +1,165 @@
+package imgproc
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// paletteSize is the number of dominant colors extracted on upload.
+const paletteSize = 5
+
+// properties fills the dimensions, size and metadata of the image. The
+// dimensions are the displayed ones, after applying the EXIF orientation.
+// head holds the first bytes of the upload.
+func properties(
+	ctx context.Context,
+	spool *storage.Spool,
+	head []byte,
+	img image.Image,
+	imgInfo *models.Image,
+) {
+	bounds := img.Bounds()
+	imgInfo.Width, imgInfo.Height = bounds.Dx(), bounds.Dy()
+	if orientation(head) >= 5 {
+		imgInfo.Width, imgInfo.Height = imgInfo.Height, imgInfo.Width
+	}
+
+	imgInfo.Size = spool.Size()
+	imgInfo.Metadata = models.ImageMetadata{
+		ColorModel: colorModel(img),
+		HasAlpha:   hasAlpha(img),
+		Palette:    dominantColors(img, paletteSize),
+	}
+
+	if isPDF(head) {
+		infoCtx, cancel := context.WithTimeout(ctx, pdfTimeout)
+		defer cancel()
+
+		if info, err := readPDFInfo(infoCtx, spool.Name(), 1); err == nil {
+			imgInfo.Metadata.Pages = info.pages
+		}
+	}
+
+	exifMetadata(head, &imgInfo.Metadata)
+}
+
+func colorModel(img image.Image) string {
+	switch img.(type) {
+	case *image.YCbCr:
+		return "ycbcr"
+	case *image.NYCbCrA:
+		return "nycbcra"
+	case *image.Gray, *image.Gray16:
+		return "gray"
+	case *image.CMYK:
+		return "cmyk"
+	case *image.Paletted:
+		return "paletted"
+	case *image.NRGBA, *image.NRGBA64:
+		return "nrgba"
+	case *image.Alpha, *image.Alpha16:
+		return "alpha"
+	default:
+		return "rgba"
+	}
+}
+
+// exifMetadata copies the camera, the date taken and the GPS position from
+// the EXIF data, when present.
+func exifMetadata(imgData []byte, metadata *models.ImageMetadata) {
+	x, err := exif.Decode(bytes.NewReader(imgData))
+	if err != nil {
+		return
+	}
+
+	if tag, err := x.Get(exif.Make); err == nil {
+		metadata.CameraMake, _ = tag.StringVal()
+		metadata.CameraMake = strings.TrimSpace(metadata.CameraMake)
+	}
+
+	if tag, err := x.Get(exif.Model); err == nil {
+		metadata.CameraModel, _ = tag.StringVal()
+		metadata.CameraModel = strings.TrimSpace(metadata.CameraModel)
+	}
+
+	if takenAt, err := x.DateTime(); err == nil {
+		metadata.TakenAt = &takenAt
+	}
+
+	if lat, long, err := x.LatLong(); err == nil {
+		metadata.GPS = &models.GPS{Latitude: lat, Longitude: long}
+	}
+}
+
+// dominantColors returns the n most frequent colors of the image. Colors are
+// grouped in buckets of 4 bits per channel and each bucket is reported as
+// the average of its colors. Transparent pixels are ignored.
+func dominantColors(img image.Image, n int) []string {
+	bounds := img.Bounds()
+	scale := min(1, 64/float64(max(bounds.Dx(), bounds.Dy())))
+	sample := transform.Resize(
+		img,
+		max(1, int(float64(bounds.Dx())*scale)),
+		max(1, int(float64(bounds.Dy())*scale)),
+		transform.Box,
+	)
+
+	type bucket struct {
+		key, r, g, b, count int
+	}
+
+	buckets := make(map[int]*bucket)
+	for i := 0; i+3 < len(sample.Pix); i += 4 {
+		p := sample.Pix[i : i+4 : i+4]
+		if p[3] < 128 {
+			continue
+		}
+
+		key := int(p[0]>>4)<<8 | int(p[1]>>4)<<4 | int(p[2]>>4)
+		bkt, ok := buckets[key]
+		if !ok {
+			bkt = &bucket{key: key}
+			buckets[key] = bkt
+		}
+
+		bkt.r += int(p[0])
+		bkt.g += int(p[1])
+		bkt.b += int(p[2])
+		bkt.count++
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bkt := range buckets {
+		sorted = append(sorted, bkt)
+	}
+
+	slices.SortFunc(sorted, func(a, b *bucket) int {
+		if c := cmp.Compare(b.count, a.count); c != 0 {
+			return c
+		}
+		// Keep the order stable for buckets with the same count.
+		return cmp.Compare(a.key, b.key)
+	})
+
+	colors := make([]string, 0, n)
+	for _, bkt := range sorted[:min(n, len(sorted))] {
+		colors = append(colors, fmt.Sprintf(
+			"#%02x%02x%02x",
+			bkt.r/bkt.count,
+			bkt.g/bkt.count,
+			bkt.b/bkt.count,
+		))
+	}
+
+	return colors
+}
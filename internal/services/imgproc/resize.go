@@ -0,0 +1,144 @@
+package imgproc
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/anthonynsimon/bild/transform"
+)
+
+const (
+	// FitFill stretches the image to the exact requested size.
+	FitFill = "fill"
+	// FitCover keeps the aspect ratio and crops the overflow so the image
+	// covers the requested size.
+	FitCover = "cover"
+	// FitContain keeps the aspect ratio and letterboxes the image inside
+	// the requested size using the background color.
+	FitContain = "contain"
+	// FitInside keeps the aspect ratio so the image is at most the
+	// requested size.
+	FitInside = "inside"
+	// FitOutside keeps the aspect ratio so the image is at least the
+	// requested size.
+	FitOutside = "outside"
+)
+
+type Resize struct {
+	Width  int `json:"width" validate:"gte=0"`
+	Height int `json:"height" validate:"gte=0"`
+
+	// Fit is only used when both dimensions are given. With a single
+	// dimension the other one is derived from the aspect ratio.
+	Fit string `json:"fit" validate:"omitempty,oneof=fill cover contain inside outside"`
+	// Background fills the letterbox of the contain fit. It is transparent
+	// by default, white for formats without alpha such as jpeg.
+	Background string `json:"background" validate:"omitempty,hexcolor"`
+
+	// Gravity places the crop window of the cover fit, center by default.
+	Gravity string `json:"gravity" validate:"omitempty,oneof=center north south east west north-east north-west south-east south-west auto"`
+
+	// Filter is the resampling filter, linear by default.
+	Filter string `json:"filter" validate:"omitempty,oneof=nearest box linear gaussian mitchell catmullrom lanczos"`
+}
+
+var resampleFilters = map[string]transform.ResampleFilter{
+	"nearest":    transform.NearestNeighbor,
+	"box":        transform.Box,
+	"linear":     transform.Linear,
+	"gaussian":   transform.Gaussian,
+	"mitchell":   transform.MitchellNetravali,
+	"catmullrom": transform.CatmullRom,
+	"lanczos":    transform.Lanczos,
+}
+
+func resize(img image.Image, r *Resize, pins anchors) image.Image {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	if (r.Width <= 0 && r.Height <= 0) || srcW == 0 || srcH == 0 {
+		return img
+	}
+
+	scaleX := float64(r.Width) / float64(srcW)
+	scaleY := float64(r.Height) / float64(srcH)
+
+	if r.Width <= 0 || r.Height <= 0 {
+		scale := max(scaleX, scaleY)
+		return scale2D(img, scale, r.Filter)
+	}
+
+	switch r.Fit {
+	case FitCover:
+		resized := scale2D(img, max(scaleX, scaleY), r.Filter)
+		return cropGravity(resized, r.Width, r.Height, r.Gravity, pins, r)
+	case FitContain:
+		resized := scale2D(img, min(scaleX, scaleY), r.Filter)
+		return letterbox(resized, r.Width, r.Height, r.Background)
+	case FitInside:
+		return scale2D(img, min(scaleX, scaleY), r.Filter)
+	case FitOutside:
+		return scale2D(img, max(scaleX, scaleY), r.Filter)
+	default:
+		return resample(img, r.Width, r.Height, r.Filter)
+	}
+}
+
+// scale2D resizes the image by the same factor on both axes.
+func scale2D(img image.Image, scale float64, filter string) image.Image {
+	w := max(1, int(math.Round(float64(img.Bounds().Dx())*scale)))
+	h := max(1, int(math.Round(float64(img.Bounds().Dy())*scale)))
+
+	return resample(img, w, h, filter)
+}
+
+// resample resizes the image with the named filter. Large reductions are
+// first halved with a box filter until at most a 4x reduction is left, which
+// is much faster than a single pass with a wide kernel and keeps the final
+// pass sharp.
+func resample(img image.Image, width, height int, filter string) image.Image {
+	resampleFilter, ok := resampleFilters[filter]
+	if !ok {
+		resampleFilter = transform.Linear
+	}
+
+	if filter != "nearest" {
+		for {
+			bounds := img.Bounds()
+			if bounds.Dx() < 4*width || bounds.Dy() < 4*height {
+				break
+			}
+
+			img = transform.Resize(img, bounds.Dx()/2, bounds.Dy()/2, transform.Box)
+		}
+	}
+
+	return transform.Resize(img, width, height, resampleFilter)
+}
+
+// letterbox centers the image on a width x height canvas of the background
+// color, transparent by default. Formats without alpha flatten it onto
+// white when encoding, see toJpeg.
+func letterbox(img image.Image, width, height int, background string) image.Image {
+	var bg color.Color = color.Transparent
+	if background != "" {
+		if c, err := parseHexColor(background); err == nil {
+			bg = c
+		}
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	bounds := img.Bounds()
+	offset := image.Pt((width-bounds.Dx())/2, (height-bounds.Dy())/2)
+	draw.Draw(
+		canvas,
+		image.Rectangle{Min: offset, Max: offset.Add(bounds.Size())},
+		img,
+		bounds.Min,
+		draw.Over,
+	)
+
+	return canvas
+}
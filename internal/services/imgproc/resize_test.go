@@ -0,0 +1,136 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/anthonynsimon/bild/imgio"
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+)
+
+func TestResizeFit(t *testing.T) {
+	img, err := imgio.Open("./test_data/flowers.jpg")
+	if err != nil {
+		t.Fatalf("failed to open image file: %v", err)
+	}
+
+	// Work on a smaller copy, the fit modes only depend on the 3:2 ratio.
+	img = transform.Resize(img, 600, 400, transform.Linear)
+
+	testCases := []struct {
+		name          string
+		resize        imgproc.Resize
+		width, height int
+	}{
+		{"fill", imgproc.Resize{Width: 100, Height: 100, Fit: imgproc.FitFill}, 100, 100},
+		{"cover", imgproc.Resize{Width: 100, Height: 100, Fit: imgproc.FitCover}, 100, 100},
+		{"contain", imgproc.Resize{Width: 100, Height: 100, Fit: imgproc.FitContain}, 100, 100},
+		{"inside", imgproc.Resize{Width: 100, Height: 100, Fit: imgproc.FitInside}, 100, 67},
+		{"outside", imgproc.Resize{Width: 100, Height: 100, Fit: imgproc.FitOutside}, 150, 100},
+		{"width only", imgproc.Resize{Width: 300}, 300, 200},
+		{"height only", imgproc.Resize{Height: 100}, 150, 100},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			transformed, err := imgproc.Transform(img, &imgproc.Transformations{Resize: tc.resize})
+			if err != nil {
+				t.Fatalf("failed to transform image: %v", err)
+			}
+
+			got := transformed.Bounds()
+			if got.Dx() != tc.width || got.Dy() != tc.height {
+				t.Errorf(
+					"expected image to be %dx%d, got %dx%d",
+					tc.width,
+					tc.height,
+					got.Dx(),
+					got.Dy(),
+				)
+			}
+		})
+	}
+
+	t.Run("contain background", func(t *testing.T) {
+		got, err := imgproc.Transform(img, &imgproc.Transformations{
+			Resize: imgproc.Resize{
+				Width:      100,
+				Height:     100,
+				Fit:        imgproc.FitContain,
+				Background: "#ff0000",
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		if !isColor(got, got.Bounds().Min, 0xff, 0, 0) {
+			t.Errorf("expected letterbox to be red, got %v", got.At(0, 0))
+		}
+	})
+
+	t.Run("contain default background on jpeg", func(t *testing.T) {
+		got, err := imgproc.Transform(img, &imgproc.Transformations{
+			Resize: imgproc.Resize{Width: 100, Height: 100, Fit: imgproc.FitContain},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := imgproc.Encode(buf, got, "jpeg", nil); err != nil {
+			t.Fatalf("failed to encode jpeg: %v", err)
+		}
+
+		decoded, err := jpeg.Decode(buf)
+		if err != nil {
+			t.Fatalf("failed to decode jpeg: %v", err)
+		}
+
+		r, g, b, _ := decoded.At(0, 0).RGBA()
+		if r>>8 < 0xf0 || g>>8 < 0xf0 || b>>8 < 0xf0 {
+			t.Errorf("expected a white letterbox, got %v", decoded.At(0, 0))
+		}
+	})
+}
+
+func isColor(img image.Image, p image.Point, r, g, b uint32) bool {
+	gotR, gotG, gotB, _ := img.At(p.X, p.Y).RGBA()
+	return gotR>>8 == r && gotG>>8 == g && gotB>>8 == b
+}
+
+func TestResizeFilters(t *testing.T) {
+	img, err := imgio.Open("./test_data/flowers.jpg")
+	if err != nil {
+		t.Fatalf("failed to open image file: %v", err)
+	}
+
+	filters := []string{
+		"nearest",
+		"box",
+		"linear",
+		"gaussian",
+		"mitchell",
+		"catmullrom",
+		"lanczos",
+	}
+
+	for _, filter := range filters {
+		t.Run(filter, func(t *testing.T) {
+			transformed, err := imgproc.Transform(img, &imgproc.Transformations{
+				Resize: imgproc.Resize{Width: 60, Height: 40, Filter: filter},
+			})
+			if err != nil {
+				t.Fatalf("failed to transform image: %v", err)
+			}
+
+			got := transformed.Bounds()
+			if got.Dx() != 60 || got.Dy() != 40 {
+				t.Errorf("expected image to be 60x40, got %dx%d", got.Dx(), got.Dy())
+			}
+		})
+	}
+}
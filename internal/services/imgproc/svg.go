@@ -0,0 +1,333 @@
+package imgproc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// svgElements are the elements kept by SanitizeSVG, others are removed
+// together with their children. Animations are left out since they can
+// set any attribute, references included, and so are images and foreign
+// objects which embed external content.
+var svgElements = setOf(
+	"svg", "g", "defs", "symbol", "use", "title", "desc", "switch", "a",
+	"path", "rect", "circle", "ellipse", "line", "polyline", "polygon",
+	"text", "tspan", "textpath", "marker", "style",
+	"lineargradient", "radialgradient", "stop", "pattern", "clippath", "mask",
+	"filter", "feblend", "fecolormatrix", "fecomponenttransfer", "fecomposite",
+	"feconvolvematrix", "fediffuselighting", "fedisplacementmap",
+	"fedistantlight", "fedropshadow", "feflood", "fefunca", "fefuncb",
+	"fefuncg", "fefuncr", "fegaussianblur", "femerge", "femergenode",
+	"femorphology", "feoffset", "fepointlight", "fespecularlighting",
+	"fespotlight", "fetile", "feturbulence",
+)
+
+// svgAttributes are the attributes kept by SanitizeSVG, besides namespace
+// declarations. References through href only point inside the document.
+var svgAttributes = setOf(
+	"id", "class", "style", "href", "version", "viewbox", "preserveaspectratio",
+	"x", "y", "x1", "y1", "x2", "y2", "cx", "cy", "r", "rx", "ry", "fx", "fy", "fr",
+	"width", "height", "d", "points", "transform", "pathlength",
+	"fill", "fill-opacity", "fill-rule", "stroke", "stroke-width",
+	"stroke-opacity", "stroke-linecap", "stroke-linejoin", "stroke-miterlimit",
+	"stroke-dasharray", "stroke-dashoffset", "opacity", "color", "display",
+	"visibility", "overflow", "clip-path", "clip-rule", "mask", "filter",
+	"shape-rendering", "vector-effect", "paint-order", "mix-blend-mode", "isolation",
+	"font-family", "font-size", "font-weight", "font-style", "font-variant",
+	"text-anchor", "dominant-baseline", "alignment-baseline", "baseline-shift",
+	"letter-spacing", "word-spacing", "text-decoration", "writing-mode",
+	"dx", "dy", "rotate", "textlength", "lengthadjust", "startoffset", "space",
+	"offset", "stop-color", "stop-opacity", "gradientunits", "gradienttransform",
+	"spreadmethod", "patternunits", "patterncontentunits", "patterntransform",
+	"clippathunits", "maskunits", "maskcontentunits", "markerwidth",
+	"markerheight", "markerunits", "refx", "refy", "orient", "marker-start",
+	"marker-mid", "marker-end", "filterunits", "primitiveunits",
+	"color-interpolation-filters", "in", "in2", "result", "stddeviation", "mode",
+	"operator", "k1", "k2", "k3", "k4", "values", "type", "tablevalues", "slope",
+	"intercept", "amplitude", "exponent", "flood-color", "flood-opacity",
+	"radius", "scale", "xchannelselector", "ychannelselector", "basefrequency",
+	"numoctaves", "seed", "stitchtiles", "kernelmatrix", "order", "divisor",
+	"bias", "targetx", "targety", "edgemode", "preservealpha", "surfacescale",
+	"diffuseconstant", "specularconstant", "specularexponent", "lighting-color",
+	"azimuth", "elevation", "z", "pointsatx", "pointsaty", "pointsatz",
+	"limitingconeangle", "requiredfeatures", "systemlanguage",
+)
+
+// svgNamespaces are the namespaces that may be declared.
+var svgNamespaces = setOf(
+	"http://www.w3.org/2000/svg",
+	"http://www.w3.org/1999/xlink",
+)
+
+func setOf(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+
+	return set
+}
+
+const (
+	// defaultSVGWidth and defaultSVGHeight are used for svgs without a
+	// size, as browsers do.
+	defaultSVGWidth  = 300
+	defaultSVGHeight = 150
+	// maxRasterSize caps the longest side of rasterized svgs and pdf pages.
+	maxRasterSize = 8192
+)
+
+// isSVG reports whether the data looks like an svg document.
+func isSVG(data []byte) bool {
+	head := data[:min(len(data), 1024)]
+	return bytes.Contains(bytes.ToLower(head), []byte("<svg"))
+}
+
+// SanitizeSVG rewrites the svg keeping only known safe elements and
+// attributes, without references outside of the document, processing
+// instructions and DTDs. It fails when the document is not a well formed
+// svg.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = true
+
+	out := new(bytes.Buffer)
+	depth, skipDepth, root, inStyle := 0, 0, false, false
+	for {
+		tok, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				if strings.ToLower(tok.Name.Local) != "svg" {
+					return nil, fmt.Errorf("%w: root element is not svg", ErrInvalidImage)
+				}
+				root = true
+			}
+
+			if skipDepth > 0 {
+				continue
+			}
+
+			if tok.Name.Space != "" || !svgElements[strings.ToLower(tok.Name.Local)] {
+				skipDepth = depth
+				continue
+			}
+
+			inStyle = strings.ToLower(tok.Name.Local) == "style"
+			out.WriteString("<" + qualifiedName(tok.Name))
+			for _, attr := range tok.Attr {
+				if !safeSVGAttr(attr) {
+					continue
+				}
+
+				out.WriteString(" " + qualifiedName(attr.Name) + `="`)
+				xml.EscapeText(out, []byte(attr.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			inStyle = false
+			if skipDepth == 0 {
+				out.WriteString("</" + qualifiedName(tok.Name) + ">")
+			}
+
+			if skipDepth == depth {
+				skipDepth = 0
+			}
+			depth--
+		case xml.CharData:
+			// Style sheets importing external resources are dropped.
+			if inStyle && hasExternalURL(normalizeValue(string(tok))) {
+				continue
+			}
+
+			if skipDepth == 0 && depth > 0 {
+				xml.EscapeText(out, tok)
+			}
+		}
+	}
+
+	if !root || depth != 0 {
+		return nil, fmt.Errorf("%w: malformed svg", ErrInvalidImage)
+	}
+
+	return out.Bytes(), nil
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
+
+func safeSVGAttr(attr xml.Attr) bool {
+	name := strings.ToLower(attr.Name.Local)
+	value := normalizeValue(attr.Value)
+
+	switch strings.ToLower(attr.Name.Space) {
+	case "":
+		if name == "xmlns" {
+			return svgNamespaces[strings.TrimSpace(attr.Value)]
+		}
+	case "xmlns":
+		return svgNamespaces[strings.TrimSpace(attr.Value)]
+	case "xlink", "xml":
+		if name != "href" && name != "space" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	switch {
+	case !svgAttributes[name]:
+		return false
+	case name == "href":
+		// Only references to elements of the same document are allowed.
+		return strings.HasPrefix(value, "#")
+	case strings.Contains(value, "javascript:"), strings.Contains(value, "expression("):
+		return false
+	}
+
+	return !hasExternalURL(value)
+}
+
+// hasExternalURL reports whether a normalized css value references
+// anything outside of the document through url() or @import.
+func hasExternalURL(value string) bool {
+	if strings.Contains(value, "@import") {
+		return true
+	}
+
+	for rest := value; ; {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			return false
+		}
+
+		rest = strings.TrimLeft(rest[i+len("url("):], `'"`)
+		if !strings.HasPrefix(rest, "#") {
+			return true
+		}
+	}
+}
+
+// normalizeValue lowercases the value and removes whitespace, control
+// characters and css escapes, which browsers tolerate inside schemes and
+// functions, so they can't hide a reference.
+func normalizeValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		r, size := utf8.DecodeRuneInString(value[i:])
+		i += size
+
+		if r == '\\' {
+			j := i
+			for j < len(value) && j-i < 6 && isHexDigit(value[j]) {
+				j++
+			}
+
+			switch {
+			case j > i:
+				code, _ := strconv.ParseUint(value[i:j], 16, 32)
+				r, i = rune(code), j
+			case i < len(value):
+				r, size = utf8.DecodeRuneInString(value[i:])
+				i += size
+			}
+		}
+
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// rasterizeSVG renders the svg at the given size. A zero width or height
+// is derived from the other using the aspect ratio of the svg, and both
+// zero render the svg at its own size. The size is reduced to fit the
+// limits.
+func rasterizeSVG(data []byte, width, height int, limits Limits) (image.Image, error) {
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode svg: %w", err)
+	}
+
+	w, h := icon.ViewBox.W, icon.ViewBox.H
+	if w <= 0 || h <= 0 {
+		w, h = defaultSVGWidth, defaultSVGHeight
+	}
+
+	scale := 1.0
+	switch {
+	case width > 0 && height > 0:
+		scale = math.Max(float64(width)/w, float64(height)/h)
+	case width > 0:
+		scale = float64(width) / w
+	case height > 0:
+		scale = float64(height) / h
+	}
+	dstW, dstH := rasterSize(w, h, scale, limits)
+
+	icon.SetTarget(0, 0, float64(dstW), float64(dstH))
+	img := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	scanner := rasterx.NewScannerGV(dstW, dstH, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(dstW, dstH, scanner), 1)
+
+	return img, nil
+}
+
+// rasterSize returns the size of a w x h vector rendered at scale, capped
+// at maxRasterSize and scaled down to fit the limits.
+func rasterSize(w, h, scale float64, limits Limits) (int, int) {
+	scale = math.Min(scale, maxRasterSize/math.Max(w, h))
+
+	round := math.Round
+	if fit := limits.fit(w*scale, h*scale); fit < 1 {
+		scale *= fit
+		round = math.Floor
+	}
+
+	return max(1, int(round(w*scale))), max(1, int(round(h*scale)))
+}
+
+// targetSize returns the size of the first resize of the pipeline, so
+// svgs and pdf pages are rendered at the requested size instead of being upscaled.
+func targetSize(t *Transformations) (int, int) {
+	for _, step := range t.pipeline() {
+		if step.Resize != nil && (step.Resize.Width > 0 || step.Resize.Height > 0) {
+			return step.Resize.Width, step.Resize.Height
+		}
+	}
+
+	return 0, 0
+}
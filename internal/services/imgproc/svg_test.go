@@ -0,0 +1,155 @@
+package imgproc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/domain/user"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
+)
+
+const testSVG = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd">
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 100 50" onload="alert(1)">
+	<script>alert("xss")</script>
+	<style>@import url(https://evil.example/style.css);</style>
+	<defs><rect id="box" width="100" height="50" fill="#ff0000"/></defs>
+	<use xlink:href="#box"/>
+	<image xlink:href="https://evil.example/pixel.png" width="1" height="1"/>
+	<foreignObject><div xmlns="http://www.w3.org/1999/xhtml">html</div></foreignObject>
+	<a href="javascript:alert(1)"><text>link</text></a>
+	<a><set attributeName="href" to="java&#9;script:alert(1)"/><text>set</text></a>
+	<a><animate attributeName="xlink:href" values="javascript:alert(1)"/></a>
+	<use href="java&#x0A;script:alert(1)"/>
+	<rect width="10" height="10" fill="u\72 l(https://evil.example/fill.png)"/>
+	<rect width="10" height="10" style="background: URL ( https://evil.example/bg.png )"/>
+	<style>rect { fill: u\72l(https://evil.example/style.png) }</style>
+	<rect width="10" height="10" fill="url(#gradient)" onclick="alert(1)"/>
+</svg>`
+
+func TestSanitizeSVG(t *testing.T) {
+	sanitized, err := imgproc.SanitizeSVG([]byte(testSVG))
+	if err != nil {
+		t.Fatalf("failed to sanitize svg: %v", err)
+	}
+
+	got := string(sanitized)
+	for _, unsafe := range []string{
+		"<script", "alert", "onload", "onclick", "@import", "evil.example", "foreignObject", "DOCTYPE", "javascript:",
+		"<set", "<animate", "<image", "script:",
+	} {
+		if strings.Contains(got, unsafe) {
+			t.Errorf("expected %q to be removed, got %s", unsafe, got)
+		}
+	}
+
+	for _, safe := range []string{
+		`xlink:href="#box"`, `fill="url(#gradient)"`, `viewBox="0 0 100 50"`, "<text>link</text>", "<text>set</text>",
+	} {
+		if !strings.Contains(got, safe) {
+			t.Errorf("expected %q to be kept, got %s", safe, got)
+		}
+	}
+
+	invalid := map[string]string{
+		"not svg":   `<html><body></body></html>`,
+		"malformed": `<svg><rect></svg>`,
+		"empty":     ``,
+	}
+
+	for name, svg := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := imgproc.SanitizeSVG([]byte(svg)); !errors.Is(err, imgproc.ErrInvalidImage) {
+				t.Errorf("expected ErrInvalidImage, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSVGUpload(t *testing.T) {
+	ctx := context.Background()
+
+	userRepo := user.NewMemoryRepo()
+	imgRepo := img.NewMemoryRepo()
+	contentStore := storage.NewContentStore(storage.NewFSImageStorage("test_data", ""), blob.NewMemoryRepo())
+
+	usr, _ := userRepo.Create(ctx, models.User{
+		Username:     "test",
+		PasswordHash: "test",
+	})
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll("./test_data/blobs")
+	})
+
+	upload := imgproc.NewUpload(userRepo, imgRepo, contentStore, imgproc.TierLimits{})
+	imgInfo, err := upload.Do(ctx, usr.ID, []byte(testSVG), &imgproc.ImageMetadata{
+		Filename: "logo.svg",
+		Format:   "svg",
+	})
+	if err != nil {
+		t.Fatalf("could not upload svg: %v", err)
+	}
+
+	t.Run("stores the sanitized vector", func(t *testing.T) {
+		stored, err := os.ReadFile("./test_data/" + imgInfo.StorageKey)
+		if err != nil {
+			t.Fatalf("could not read stored svg: %v", err)
+		}
+
+		if !bytes.HasPrefix(stored, []byte("<svg")) || bytes.Contains(stored, []byte("script")) {
+			t.Errorf("expected the sanitized svg to be stored, got %s", stored)
+		}
+
+		if imgInfo.Width != 100 || imgInfo.Height != 50 {
+			t.Errorf("expected 100x50, got %dx%d", imgInfo.Width, imgInfo.Height)
+		}
+	})
+
+	t.Run("rasterizes at the requested size", func(t *testing.T) {
+		sut := imgproc.NewDelivery(userRepo, imgRepo, contentStore, imgproc.TierLimits{}, false)
+		imgData, format, err := sut.Do(ctx, usr.ID, "logo.svg", &imgproc.Transformations{
+			Resize: imgproc.Resize{Width: 400},
+		}, "")
+		if err != nil {
+			t.Fatalf("could not deliver svg: %v", err)
+		}
+
+		if format != "png" {
+			t.Errorf("expected svgs to be delivered as png by default, got %s", format)
+		}
+
+		got, err := png.Decode(bytes.NewReader(imgData))
+		if err != nil {
+			t.Fatalf("failed to decode png: %v", err)
+		}
+
+		if got.Bounds().Dx() != 400 || got.Bounds().Dy() != 200 {
+			t.Errorf("expected 400x200, got %v", got.Bounds().Size())
+		}
+
+		if !isColor(got, image.Pt(200, 100), 0xff, 0, 0) {
+			t.Errorf("expected the rect to be red, got %v", got.At(200, 100))
+		}
+	})
+
+	t.Run("rejects invalid svg", func(t *testing.T) {
+		_, err := upload.Do(ctx, usr.ID, []byte(`<svg><script>`), &imgproc.ImageMetadata{
+			Filename: "broken.svg",
+			Format:   "svg",
+		})
+		if err != imgproc.ErrInvalidImage {
+			t.Errorf("expected ErrInvalidImage, got: %v", err)
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"io"
 
 	"github.com/edulustosa/imago/internal/database/models"
 	"github.com/edulustosa/imago/internal/domain/img"
@@ -17,18 +18,21 @@ import (
 type Upload struct {
 	userRepository  user.Repository
 	imageRepository img.Repository
-	imageStorage    storage.ImageStorage
+	contentStore    *storage.ContentStore
+	limits          TierLimits
 }
 
 func NewUpload(
 	userRepository user.Repository,
 	imageRepository img.Repository,
-	imageStorage storage.ImageStorage,
+	contentStore *storage.ContentStore,
+	limits TierLimits,
 ) *Upload {
 	return &Upload{
 		userRepository,
 		imageRepository,
-		imageStorage,
+		contentStore,
+		limits,
 	}
 }
 
@@ -36,52 +40,194 @@ type ImageMetadata struct {
 	Filename string
 	Format   string
 	Alt      string
+	// Dedupe returns an already uploaded near-duplicate instead of storing
+	// the image again.
+	Dedupe bool
+	// Public images keep their public url when the bucket is private.
+	Public bool
 }
 
+// DuplicateDistance is the largest Hamming distance between the perceptual
+// hashes of two images considered duplicates.
+const DuplicateDistance = 4
+
 var (
 	ErrUserNotFound = errors.New("user not found")
 	ErrInvalidImage = errors.New("failed to decode image: invalid format")
+	ErrImageExists  = errors.New("an image with a different content already uses this filename")
 )
 
+// sniffSize is the number of leading bytes of uploads read to sniff their
+// format and EXIF metadata, which JPEG keeps in its first 64KB.
+const sniffSize = 1 << 20
+
+// Do stores an upload held in memory, see DoSpool.
 func (u *Upload) Do(
 	ctx context.Context,
 	userID uuid.UUID,
 	imgFile []byte,
 	metadata *ImageMetadata,
+) (*models.Image, error) {
+	spool, err := storage.NewSpool(bytes.NewReader(imgFile))
+	if err != nil {
+		return nil, err
+	}
+	defer spool.Close()
+
+	return u.DoSpool(ctx, userID, spool, metadata)
+}
+
+// DoSpool stores an upload spooled to disk. Only the decoded image and the
+// first bytes of the file are kept in memory, the file itself is streamed
+// to the storage.
+func (u *Upload) DoSpool(
+	ctx context.Context,
+	userID uuid.UUID,
+	spool *storage.Spool,
+	metadata *ImageMetadata,
 ) (*models.Image, error) {
 	usr, err := u.userRepository.FindByID(ctx, userID)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
 
-	_, format, err := image.Decode(bytes.NewReader(imgFile))
-	if err != nil || !isSameFormat(format, metadata.Format) {
+	// Svgs are stored sanitized, since they are served as they are.
+	if metadata.Format == "svg" {
+		svg, err := io.ReadAll(spool.Reader())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read svg: %w", err)
+		}
+
+		svg, err = SanitizeSVG(svg)
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+
+		if spool, err = storage.NewSpool(bytes.NewReader(svg)); err != nil {
+			return nil, err
+		}
+		defer spool.Close()
+	}
+
+	limits := u.limits.For(usr.Tier)
+	if err := limits.checkData(spool.Reader()); err != nil {
+		return nil, err
+	}
+
+	decoded, err := decodeUpload(spool, metadata.Format, limits)
+	if err != nil {
 		return nil, ErrInvalidImage
 	}
 
-	imgURL, err := u.imageStorage.Upload(
-		ctx,
-		imgFile,
-		fmt.Sprintf("%s/%s", usr.ID.String(), metadata.Filename),
-	)
+	return u.store(ctx, usr, spool, decoded, metadata)
+}
+
+// store saves the file unless it is a duplicate and creates its image. The
+// hash and properties are taken from decoded.
+func (u *Upload) store(
+	ctx context.Context,
+	usr *models.User,
+	spool *storage.Spool,
+	decoded image.Image,
+	metadata *ImageMetadata,
+) (*models.Image, error) {
+	head, err := spool.Head(sniffSize)
+	if err != nil {
+		return nil, err
+	}
+
+	phash := DHash(orient(decoded, orientation(head)))
+	if metadata.Dedupe {
+		duplicates, err := u.imageRepository.FindSimilar(ctx, usr.ID, phash, DuplicateDistance)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(duplicates) > 0 {
+			return &duplicates[0], nil
+		}
+	}
+
+	// Public images are stored apart, since the blobs of private images
+	// must not be readable without a signed url.
+	key, put := spool.Key(), u.contentStore.PutSpool
+	if metadata.Public {
+		key, put = storage.PublicKey(key), u.contentStore.PutPublicSpool
+	}
+
+	// Filenames are unique per user, uploading the same content again under
+	// the same filename returns the existing image.
+	if imgInfo, err := u.imageRepository.FindByFilename(ctx, metadata.Filename, usr.ID); err == nil {
+		return sameContent(imgInfo, key)
+	}
+
+	key, imgURL, err := put(ctx, spool)
 	if err != nil {
 		return nil, err
 	}
 
-	imgInfo, err := u.imageRepository.FindByFilename(ctx, metadata.Filename, usr.ID)
-	if err == nil {
-		return imgInfo, nil
+	newImage := models.Image{
+		UserID:     usr.ID,
+		ImageURL:   imgURL,
+		Filename:   metadata.Filename,
+		Format:     metadata.Format,
+		Alt:        metadata.Alt,
+		PHash:      &phash,
+		StorageKey: key,
+		Public:     metadata.Public,
 	}
+	properties(ctx, spool, head, decoded, &newImage)
 
-	img := models.Image{
-		UserID:   usr.ID,
-		ImageURL: imgURL,
-		Filename: metadata.Filename,
-		Format:   metadata.Format,
-		Alt:      metadata.Alt,
+	imgInfo, err := u.imageRepository.Create(ctx, newImage)
+	if err != nil {
+		_ = u.contentStore.Release(ctx, key)
+
+		// A concurrent upload took the filename since it was checked.
+		if errors.Is(err, img.ErrFilenameTaken) {
+			if imgInfo, err := u.imageRepository.FindByFilename(ctx, metadata.Filename, usr.ID); err == nil {
+				return sameContent(imgInfo, key)
+			}
+			return nil, ErrImageExists
+		}
+
+		return nil, err
+	}
+
+	return imgInfo, nil
+}
+
+// sameContent returns the image already using the filename of an upload
+// when it has the content stored at key.
+func sameContent(imgInfo *models.Image, key string) (*models.Image, error) {
+	if imgInfo.StorageKey != key {
+		return nil, ErrImageExists
+	}
+
+	return imgInfo, nil
+}
+
+// decodeUpload decodes the image and checks it matches the declared format.
+// Svgs are rasterized at their own size, within the limits.
+func decodeUpload(spool *storage.Spool, format string, limits Limits) (image.Image, error) {
+	if format == "svg" {
+		svg, err := io.ReadAll(spool.Reader())
+		if err != nil {
+			return nil, err
+		}
+
+		return rasterizeSVG(svg, 0, 0, limits)
+	}
+
+	decoded, decodedFormat, err := image.Decode(spool.Reader())
+	if err != nil {
+		return nil, err
+	}
+
+	if !isSameFormat(decodedFormat, format) {
+		return nil, ErrInvalidImage
 	}
 
-	return u.imageRepository.Create(ctx, img)
+	return decoded, nil
 }
 
 var equivFormats = map[string]string{
@@ -89,6 +235,8 @@ var equivFormats = map[string]string{
 	"jpg":  "jpeg",
 	"tiff": "tif",
 	"tif":  "tiff",
+	"heic": "heif",
+	"heif": "heic",
 }
 
 func isSameFormat(decodedFormat, metadataFormat string) bool {
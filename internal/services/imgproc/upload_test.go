@@ -1,11 +1,18 @@
 package imgproc_test
 
 import (
+	"bytes"
 	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/edulustosa/imago/internal/database/models"
+	"github.com/edulustosa/imago/internal/domain/blob"
 	"github.com/edulustosa/imago/internal/domain/img"
 	"github.com/edulustosa/imago/internal/domain/user"
 	"github.com/edulustosa/imago/internal/services/imgproc"
@@ -18,9 +25,9 @@ func TestUploadImage(t *testing.T) {
 
 	userRepo := user.NewMemoryRepo()
 	imgRepo := img.NewMemoryRepo()
-	imageStore := storage.NewFSImageStorage("test_data")
+	imageStore := storage.NewContentStore(storage.NewFSImageStorage("test_data", ""), blob.NewMemoryRepo())
 
-	sut := imgproc.NewUpload(userRepo, imgRepo, imageStore)
+	sut := imgproc.NewUpload(userRepo, imgRepo, imageStore, imgproc.TierLimits{})
 	imgData, err := os.ReadFile("./test_data/flowers.jpg")
 	if err != nil {
 		t.Fatalf("could not read image file: %v", err)
@@ -33,7 +40,7 @@ func TestUploadImage(t *testing.T) {
 		})
 
 		t.Cleanup(func() {
-			_ = os.RemoveAll("./test_data/" + usr.ID.String())
+			_ = os.RemoveAll("./test_data/blobs")
 		})
 
 		imgInfo, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
@@ -53,6 +60,199 @@ func TestUploadImage(t *testing.T) {
 
 	reset(userRepo, imgRepo)
 
+	t.Run("extracts properties", func(t *testing.T) {
+		usr, _ := userRepo.Create(ctx, models.User{
+			Username:     "test",
+			PasswordHash: "test",
+		})
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll("./test_data/blobs")
+		})
+
+		imgInfo, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+			Filename: "flowers.jpg",
+			Format:   "jpeg",
+			Alt:      "flowers",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		if imgInfo.Width != 6000 || imgInfo.Height != 4000 || imgInfo.Size != int64(len(imgData)) {
+			t.Errorf("expected 6000x4000 and %d bytes, got %dx%d and %d bytes",
+				len(imgData), imgInfo.Width, imgInfo.Height, imgInfo.Size)
+		}
+
+		metadata := imgInfo.Metadata
+		if metadata.ColorModel != "ycbcr" || metadata.HasAlpha || len(metadata.Palette) != 5 {
+			t.Errorf("unexpected metadata: %+v", metadata)
+		}
+
+		// Dimensions are reported after applying the EXIF orientation.
+		rotated, err := sut.Do(ctx, usr.ID, rotatedJpeg(t), &imgproc.ImageMetadata{
+			Filename: "rotated.jpg",
+			Format:   "jpeg",
+			Alt:      "rotated",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		if rotated.Width != 20 || rotated.Height != 40 {
+			t.Errorf("expected 20x40, got %dx%d", rotated.Width, rotated.Height)
+		}
+
+		if len(rotated.Metadata.Palette) != 2 {
+			t.Errorf("expected 2 dominant colors, got %v", rotated.Metadata.Palette)
+		}
+	})
+
+	reset(userRepo, imgRepo)
+
+	t.Run("dedupe", func(t *testing.T) {
+		usr, _ := userRepo.Create(ctx, models.User{
+			Username:     "test",
+			PasswordHash: "test",
+		})
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll("./test_data/blobs")
+		})
+
+		imgInfo, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+			Filename: "flowers.jpg",
+			Format:   "jpeg",
+			Alt:      "flowers",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		duplicate, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+			Filename: "flowers_copy.jpg",
+			Format:   "jpeg",
+			Alt:      "flowers",
+			Dedupe:   true,
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		if duplicate.ID != imgInfo.ID {
+			t.Error("expected the first image to be returned")
+		}
+
+		if len(imgRepo.Images) != 1 {
+			t.Errorf("expected the duplicate not to be stored, got %d images", len(imgRepo.Images))
+		}
+	})
+
+	reset(userRepo, imgRepo)
+
+	t.Run("dedupes images hashed 0", func(t *testing.T) {
+		usr, _ := userRepo.Create(ctx, models.User{
+			Username:     "test",
+			PasswordHash: "test",
+		})
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll("./test_data/blobs")
+		})
+
+		// Flat images have no gradient, their hash is 0.
+		flat := func(c color.Color) []byte {
+			img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+			draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+
+			buf := new(bytes.Buffer)
+			if err := png.Encode(buf, img); err != nil {
+				t.Fatalf("failed to encode png: %v", err)
+			}
+			return buf.Bytes()
+		}
+
+		white, err := sut.Do(ctx, usr.ID, flat(color.White), &imgproc.ImageMetadata{
+			Filename: "white.png",
+			Format:   "png",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		if white.PHash == nil || *white.PHash != 0 {
+			t.Fatalf("expected a hash of 0, got %v", white.PHash)
+		}
+
+		gray, err := sut.Do(ctx, usr.ID, flat(color.Gray{Y: 128}), &imgproc.ImageMetadata{
+			Filename: "gray.png",
+			Format:   "png",
+			Dedupe:   true,
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		if gray.ID != white.ID {
+			t.Error("expected the first image to be returned")
+		}
+	})
+
+	reset(userRepo, imgRepo)
+
+	t.Run("stores public images apart", func(t *testing.T) {
+		usr, _ := userRepo.Create(ctx, models.User{
+			Username:     "test",
+			PasswordHash: "test",
+		})
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll("./test_data/blobs")
+			_ = os.RemoveAll("./test_data/public")
+		})
+
+		private, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+			Filename: "private.jpg",
+			Format:   "jpeg",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		public, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+			Filename: "public.jpg",
+			Format:   "jpeg",
+			Public:   true,
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		if !strings.HasPrefix(public.StorageKey, storage.PublicPrefix) {
+			t.Errorf("expected the public image under %q, got %q", storage.PublicPrefix, public.StorageKey)
+		}
+
+		if strings.HasPrefix(private.StorageKey, storage.PublicPrefix) || private.StorageKey == public.StorageKey {
+			t.Errorf("expected the private image not to share its object, got %q", private.StorageKey)
+		}
+
+		if _, err := os.ReadFile(public.ImageURL); err != nil {
+			t.Error("could not read public image")
+		}
+
+		// Uploading it again under the same filename returns it.
+		again, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+			Filename: "public.jpg",
+			Format:   "jpeg",
+			Public:   true,
+		})
+		if err != nil || again.ID != public.ID {
+			t.Errorf("expected the public image to be returned, got %v", err)
+		}
+	})
+
+	reset(userRepo, imgRepo)
+
 	t.Run("invalid user", func(t *testing.T) {
 		_, err := sut.Do(ctx, uuid.Nil, imgData, &imgproc.ImageMetadata{
 			Filename: "flowers.jpg",
@@ -91,7 +291,7 @@ func TestUploadImage(t *testing.T) {
 		})
 
 		t.Cleanup(func() {
-			_ = os.RemoveAll("./test_data/" + usr.ID.String())
+			_ = os.RemoveAll("./test_data/blobs")
 		})
 
 		imgInfo, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
@@ -116,6 +316,124 @@ func TestUploadImage(t *testing.T) {
 			t.Error("expected the same image to be returned")
 		}
 	})
+
+	reset(userRepo, imgRepo)
+
+	t.Run("filename taken by a different image", func(t *testing.T) {
+		usr, _ := userRepo.Create(ctx, models.User{
+			Username:     "test",
+			PasswordHash: "test",
+		})
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll("./test_data/blobs")
+		})
+
+		_, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+			Filename: "photo.jpg",
+			Format:   "jpeg",
+			Alt:      "flowers",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		_, err = sut.Do(ctx, usr.ID, rotatedJpeg(t), &imgproc.ImageMetadata{
+			Filename: "photo.jpg",
+			Format:   "jpeg",
+			Alt:      "rotated",
+		})
+		if err != imgproc.ErrImageExists {
+			t.Errorf("expected ErrImageExists, got: %v", err)
+		}
+	})
+
+	reset(userRepo, imgRepo)
+
+	t.Run("stores identical content once", func(t *testing.T) {
+		usr, _ := userRepo.Create(ctx, models.User{
+			Username:     "test",
+			PasswordHash: "test",
+		})
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll("./test_data/blobs")
+		})
+
+		first, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+			Filename: "flowers.jpg",
+			Format:   "jpeg",
+			Alt:      "flowers",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		second, err := sut.Do(ctx, usr.ID, imgData, &imgproc.ImageMetadata{
+			Filename: "flowers_copy.jpg",
+			Format:   "jpeg",
+			Alt:      "flowers",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		if first.ID == second.ID {
+			t.Error("expected a new image to be created")
+		}
+
+		if first.StorageKey != second.StorageKey || first.StorageKey != storage.ContentKey(imgData) {
+			t.Errorf("expected both images to share the content key, got %q and %q",
+				first.StorageKey, second.StorageKey)
+		}
+	})
+
+	reset(userRepo, imgRepo)
+
+	t.Run("streams spooled uploads", func(t *testing.T) {
+		usr, _ := userRepo.Create(ctx, models.User{
+			Username:     "test",
+			PasswordHash: "test",
+		})
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll("./test_data/blobs")
+		})
+
+		imgFile, err := os.Open("./test_data/flowers.jpg")
+		if err != nil {
+			t.Fatalf("could not open image file: %v", err)
+		}
+		defer imgFile.Close()
+
+		spool, err := storage.NewSpool(imgFile)
+		if err != nil {
+			t.Fatalf("could not spool image: %v", err)
+		}
+		defer spool.Close()
+
+		imgInfo, err := sut.DoSpool(ctx, usr.ID, spool, &imgproc.ImageMetadata{
+			Filename: "flowers.jpg",
+			Format:   "jpeg",
+		})
+		if err != nil {
+			t.Fatalf("could not upload image: %v", err)
+		}
+
+		stored, err := os.ReadFile(imgInfo.ImageURL)
+		if err != nil {
+			t.Fatalf("could not read uploaded image: %v", err)
+		}
+
+		if !bytes.Equal(stored, imgData) || imgInfo.StorageKey != storage.ContentKey(imgData) {
+			t.Error("expected the spooled content to be stored under its content key")
+		}
+
+		if imgInfo.Size != int64(len(imgData)) || imgInfo.Width != 6000 {
+			t.Errorf("expected the properties of the spooled image, got %d bytes and %d wide",
+				imgInfo.Size, imgInfo.Width)
+		}
+	})
 }
 
 func reset(userRepo *user.MemoryRepo, image *img.MemoryRepo) {
@@ -0,0 +1,234 @@
+package imgproc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidTransformations = errors.New("invalid transformations")
+
+// cropModes maps the delivery URL crop modes to resize fit modes.
+var cropModes = map[string]string{
+	"scale": FitFill,
+	"fill":  FitCover,
+	"fit":   FitInside,
+	"mfit":  FitOutside,
+	"pad":   FitContain,
+}
+
+// ParseTransformations parses a compact, comma separated transformation
+// string as used in delivery URLs, e.g. "w_300,h_200,c_crop,x_10,y_10,f_webp".
+//
+// Supported parameters:
+//
+//	w_<int>     width
+//	h_<int>     height
+//	c_<mode>    scale (default) stretches to w/h, fill covers w/h, fit fits
+//	            inside w/h, mfit fits outside w/h, pad letterboxes in w/h and
+//	            crop crops w/h at x/y
+//	b_<hex>     background color used by pad, e.g. b_ffffff
+//	g_<gravity> gravity used by fill and crop, e.g. g_north_east or g_auto
+//	x_<int>     crop x offset
+//	y_<int>     crop y offset
+//	a_<float>   rotation angle in degrees
+//	e_<effect>  grayscale, sepia, invert, emboss, sharpen, blur:<radius>,
+//	            brightness:<percent>, contrast:<percent>,
+//	            saturation:<percent>, gamma:<float>, hue:<degrees>,
+//	            edge:<radius> or denoise:<radius>, may be repeated
+//	q_<int>     output quality for jpeg and webp
+//	fr_<int>    frame of an animation, starting at 1, or fr_poster for the
+//	            most detailed frame
+//	page_<int>  page of a pdf document, starting at 1
+//	f_<format>  output format, auto negotiates it from the Accept header
+func ParseTransformations(s string) (*Transformations, error) {
+	var (
+		t                   Transformations
+		width, height, x, y int
+		mode                = "scale"
+		background          string
+		gravity             string
+	)
+
+	for _, param := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(param, "_")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: malformed parameter %q", ErrInvalidTransformations, param)
+		}
+
+		var err error
+		switch key {
+		case "w":
+			width, err = parseNonNegativeInt(value)
+		case "h":
+			height, err = parseNonNegativeInt(value)
+		case "x":
+			x, err = parseNonNegativeInt(value)
+		case "y":
+			y, err = parseNonNegativeInt(value)
+		case "c":
+			if _, ok := cropModes[value]; !ok && value != "crop" {
+				err = fmt.Errorf("unsupported crop mode %q", value)
+			}
+			mode = value
+		case "b":
+			_, err = parseHexColor(value)
+			background = "#" + value
+		case "g":
+			gravity = strings.ReplaceAll(value, "_", "-")
+			if _, ok := gravityOffsets[gravity]; !ok && gravity != GravityAuto {
+				err = fmt.Errorf("unsupported gravity %q", value)
+			}
+		case "a":
+			t.Rotate, err = parseFloat(value)
+		case "e":
+			err = parseEffect(&t.Filters, value)
+		case "q":
+			t.Output.Quality, err = strconv.Atoi(value)
+			if err == nil && (t.Output.Quality < 1 || t.Output.Quality > 100) {
+				err = errors.New("must be between 1 and 100")
+			}
+		case "fr":
+			err = parseFrame(&t.Animation, value)
+		case "page":
+			t.Page, err = strconv.Atoi(value)
+			if err == nil && t.Page < 1 {
+				err = errors.New("must be at least 1")
+			}
+		case "f":
+			if _, ok := Encoders[value]; !ok && value != FormatAuto {
+				err = ErrUnsupportedFormat
+			}
+			t.Format = value
+		default:
+			err = fmt.Errorf("unknown parameter %q", key)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidTransformations, param, err)
+		}
+	}
+
+	if mode == "crop" {
+		t.Crop = Crop{Width: width, Height: height, X: x, Y: y, Gravity: gravity}
+	} else {
+		t.Resize = Resize{
+			Width:      width,
+			Height:     height,
+			Fit:        cropModes[mode],
+			Background: background,
+			Gravity:    gravity,
+		}
+	}
+
+	return &t, nil
+}
+
+// parseEffect parses an effect with an optional value, e.g. "blur:2", into
+// the filters.
+func parseEffect(f *Filters, effect string) error {
+	name, value, hasValue := strings.Cut(effect, ":")
+	number := func(low, high float64) (float64, error) {
+		if !hasValue {
+			return 0, errors.New("missing value")
+		}
+
+		v, err := parseFloat(value)
+		if err != nil {
+			return 0, err
+		}
+
+		if v < low || v > high {
+			return 0, fmt.Errorf("must be between %g and %g", low, high)
+		}
+
+		return v, nil
+	}
+
+	var (
+		v   float64
+		err error
+	)
+
+	switch name {
+	case "grayscale":
+		f.Grayscale = true
+	case "sepia":
+		f.Sepia = true
+	case "invert":
+		f.Invert = true
+	case "emboss":
+		f.Emboss = true
+	case "sharpen":
+		f.Sharpen = true
+	case "blur":
+		f.Blur, err = number(0, 50)
+	case "brightness":
+		v, err = number(-100, 100)
+		f.Brightness = v / 100
+	case "contrast":
+		v, err = number(-100, 100)
+		f.Contrast = v / 100
+	case "saturation":
+		v, err = number(-100, 100)
+		f.Saturation = v / 100
+	case "gamma":
+		f.Gamma, err = number(0.01, 10)
+	case "hue":
+		v, err = number(-360, 360)
+		f.Hue = int(v)
+	case "edge":
+		f.EdgeDetection, err = number(0, 10)
+	case "denoise":
+		f.Denoise, err = number(0, 10)
+	default:
+		err = fmt.Errorf("unsupported effect %q", name)
+	}
+
+	return err
+}
+
+// parseFloat parses a finite number. NaN would pass any range check.
+func parseFloat(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, errors.New("must be a finite number")
+	}
+
+	return v, nil
+}
+
+func parseNonNegativeInt(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 0 {
+		return 0, errors.New("must not be negative")
+	}
+
+	return n, nil
+}
+
+// parseFrame parses fr_<n>, the 1-based frame of an animation, or fr_poster.
+func parseFrame(a *Animation, value string) error {
+	if value == "poster" {
+		a.Poster = true
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return errors.New("must be a positive frame number or poster")
+	}
+
+	a.Frame = &n
+	return nil
+}
@@ -0,0 +1,142 @@
+package imgproc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/services/imgproc"
+)
+
+func TestParseTransformations(t *testing.T) {
+	t.Run("resize", func(t *testing.T) {
+		got, err := imgproc.ParseTransformations("w_300,h_200,f_webp")
+		if err != nil {
+			t.Fatalf("failed to parse transformations: %v", err)
+		}
+
+		if got.Resize.Width != 300 || got.Resize.Height != 200 {
+			t.Errorf("expected resize to be 300x200, got %dx%d", got.Resize.Width, got.Resize.Height)
+		}
+
+		if got.Format != "webp" {
+			t.Errorf("expected format to be webp, got %s", got.Format)
+		}
+	})
+
+	t.Run("crop", func(t *testing.T) {
+		got, err := imgproc.ParseTransformations("c_crop,w_100,h_50,x_10,y_20,a_90,e_sepia")
+		if err != nil {
+			t.Fatalf("failed to parse transformations: %v", err)
+		}
+
+		want := imgproc.Crop{Width: 100, Height: 50, X: 10, Y: 20}
+		if got.Crop != want {
+			t.Errorf("expected crop to be %+v, got %+v", want, got.Crop)
+		}
+
+		if got.Resize.Width != 0 || got.Resize.Height != 0 {
+			t.Error("expected no resize when cropping")
+		}
+
+		if got.Rotate != 90 || !got.Filters.Sepia {
+			t.Errorf("expected rotate 90 and sepia, got %+v", got)
+		}
+	})
+
+	t.Run("fit modes", func(t *testing.T) {
+		got, err := imgproc.ParseTransformations("w_300,h_200,c_pad,b_ffffff")
+		if err != nil {
+			t.Fatalf("failed to parse transformations: %v", err)
+		}
+
+		if got.Resize.Fit != imgproc.FitContain || got.Resize.Background != "#ffffff" {
+			t.Errorf("expected contain fit with white background, got %+v", got.Resize)
+		}
+	})
+
+	t.Run("effects", func(t *testing.T) {
+		got, err := imgproc.ParseTransformations("e_blur:2,e_brightness:-20,e_invert,e_hue:90")
+		if err != nil {
+			t.Fatalf("failed to parse transformations: %v", err)
+		}
+
+		want := imgproc.Filters{Blur: 2, Brightness: -0.2, Invert: true, Hue: 90}
+		if got.Filters != want {
+			t.Errorf("expected filters to be %+v, got %+v", want, got.Filters)
+		}
+	})
+
+	t.Run("gravity", func(t *testing.T) {
+		got, err := imgproc.ParseTransformations("c_crop,w_100,h_100,g_south_east")
+		if err != nil {
+			t.Fatalf("failed to parse transformations: %v", err)
+		}
+
+		if got.Crop.Gravity != imgproc.GravitySouthEast {
+			t.Errorf("expected south-east gravity, got %q", got.Crop.Gravity)
+		}
+	})
+
+	t.Run("frames", func(t *testing.T) {
+		got, err := imgproc.ParseTransformations("fr_2")
+		if err != nil {
+			t.Fatalf("failed to parse transformations: %v", err)
+		}
+
+		if got.Animation.Frame == nil || *got.Animation.Frame != 2 {
+			t.Errorf("expected frame 2, got %+v", got.Animation)
+		}
+
+		got, err = imgproc.ParseTransformations("fr_poster")
+		if err != nil {
+			t.Fatalf("failed to parse transformations: %v", err)
+		}
+
+		if !got.Animation.Poster {
+			t.Error("expected poster")
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		got, err := imgproc.ParseTransformations("page_3,w_100")
+		if err != nil {
+			t.Fatalf("failed to parse transformations: %v", err)
+		}
+
+		if got.Page != 3 {
+			t.Errorf("expected page 3, got %d", got.Page)
+		}
+	})
+
+	invalid := []string{
+		"w_abc",
+		"w_-10",
+		"q",
+		"z_10",
+		"e_blur",
+		"e_blur:100",
+		"e_glow",
+		"e_gamma:NaN",
+		"e_edge:NaN",
+		"e_denoise:NaN",
+		"e_hue:NaN",
+		"a_NaN",
+		"a_Inf",
+		"c_thumb",
+		"b_zzz",
+		"g_up",
+		"f_svg",
+		"fr_0",
+		"fr_first",
+		"page_0",
+	}
+
+	for _, s := range invalid {
+		t.Run("invalid "+s, func(t *testing.T) {
+			_, err := imgproc.ParseTransformations(s)
+			if !errors.Is(err, imgproc.ErrInvalidTransformations) {
+				t.Errorf("expected ErrInvalidTransformations, got %v", err)
+			}
+		})
+	}
+}
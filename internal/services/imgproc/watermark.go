@@ -0,0 +1,250 @@
+package imgproc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/edulustosa/imago/internal/domain/img"
+	"github.com/edulustosa/imago/internal/storage"
+	"github.com/google/uuid"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Watermark overlays either another of the user's images or rendered text.
+type Watermark struct {
+	// ImageID is the id of the image used as overlay.
+	ImageID int `json:"imageId" validate:"required_without=Text,excluded_with=Text"`
+	// Scale resizes the image overlay relative to the width of the image,
+	// e.g. 0.25 makes the overlay a quarter of the image width.
+	Scale float64 `json:"scale" validate:"omitempty,gt=0,lte=1"`
+
+	Text string `json:"text" validate:"required_without=ImageID,max=256"`
+	// Font is regular (default), bold, italic or mono.
+	Font string `json:"font" validate:"omitempty,oneof=regular bold italic mono"`
+	// Size is the font size in pixels, 24 by default.
+	Size  float64 `json:"size" validate:"omitempty,gt=0,lte=512"`
+	Color string  `json:"color" validate:"omitempty,hexcolor"`
+
+	// Opacity goes from 0 to 1, fully opaque by default.
+	Opacity float64 `json:"opacity" validate:"omitempty,gt=0,lte=1"`
+	// Gravity places the watermark, south-east by default.
+	Gravity string `json:"gravity" validate:"omitempty,oneof=center north south east west north-east north-west south-east south-west"`
+	// OffsetX and OffsetY move the watermark away from the gravity edges.
+	// When tiling they are the gap between tiles.
+	OffsetX int  `json:"offsetX" validate:"gte=0"`
+	OffsetY int  `json:"offsetY" validate:"gte=0"`
+	Tile    bool `json:"tile"`
+
+	// Overlay is the decoded image of ImageID, loaded before transforming.
+	Overlay image.Image `json:"-" swaggerignore:"true"`
+}
+
+var ErrWatermarkNotFound = errors.New("watermark image not found")
+
+// maxWatermarkTiles is the number of tiles per row and column above which
+// tiles are spread apart, so tiny overlays don't draw millions of times.
+const maxWatermarkTiles = 64
+
+var fonts = map[string][]byte{
+	"regular": goregular.TTF,
+	"bold":    gobold.TTF,
+	"italic":  goitalic.TTF,
+	"mono":    gomono.TTF,
+}
+
+// loadWatermarks downloads and decodes the overlay images used by the
+// watermarks of the pipeline. Overlays must belong to the same user, and be
+// public with publicOnly.
+func loadWatermarks(
+	ctx context.Context,
+	imageRepository img.Repository,
+	imageStorage storage.Downloader,
+	userID uuid.UUID,
+	t *Transformations,
+	publicOnly bool,
+) error {
+	for _, step := range t.pipeline() {
+		wm := step.Watermark
+		if wm == nil || wm.ImageID == 0 || wm.Overlay != nil {
+			continue
+		}
+
+		imgInfo, err := imageRepository.FindByID(ctx, wm.ImageID, userID)
+		if err != nil || (publicOnly && !imgInfo.Public) {
+			return ErrWatermarkNotFound
+		}
+
+		imgFile, err := imageStorage.DownloadImage(ctx, imgInfo.StorageKey)
+		if err != nil {
+			return err
+		}
+
+		overlay, _, err := image.Decode(imgFile)
+		imgFile.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode watermark image: %w", err)
+		}
+
+		wm.Overlay = overlay
+	}
+
+	return nil
+}
+
+func watermark(img image.Image, wm *Watermark) (image.Image, error) {
+	overlay, err := watermarkOverlay(img, wm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render watermark: %w", err)
+	}
+
+	if overlay == nil {
+		return img, nil
+	}
+
+	opacity := wm.Opacity
+	if opacity == 0 {
+		opacity = 1
+	}
+
+	bounds := img.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(opacity * 255))})
+	size := overlay.Bounds().Size()
+	for _, origin := range watermarkPositions(bounds, size, wm) {
+		draw.DrawMask(
+			dst,
+			image.Rectangle{Min: origin, Max: origin.Add(size)},
+			overlay,
+			overlay.Bounds().Min,
+			mask,
+			image.Point{},
+			draw.Over,
+		)
+	}
+
+	return dst, nil
+}
+
+func watermarkOverlay(img image.Image, wm *Watermark) (image.Image, error) {
+	if wm.Text != "" {
+		return renderText(wm)
+	}
+
+	overlay := wm.Overlay
+	if overlay != nil && wm.Scale > 0 {
+		width := float64(img.Bounds().Dx()) * wm.Scale
+		overlay = scale2D(overlay, width/float64(overlay.Bounds().Dx()), "")
+	}
+
+	return overlay, nil
+}
+
+// watermarkPositions returns the top left corners where the overlay is drawn.
+// Tiles are at most maxWatermarkTiles per row and column.
+func watermarkPositions(bounds image.Rectangle, size image.Point, wm *Watermark) []image.Point {
+	if wm.Tile {
+		var positions []image.Point
+		stepX := max(1, size.X+wm.OffsetX, ceilDiv(bounds.Dx(), maxWatermarkTiles))
+		stepY := max(1, size.Y+wm.OffsetY, ceilDiv(bounds.Dy(), maxWatermarkTiles))
+		for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+			for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+				positions = append(positions, image.Pt(x, y))
+			}
+		}
+
+		return positions
+	}
+
+	gravity := wm.Gravity
+	if gravity == "" {
+		gravity = GravitySouthEast
+	}
+
+	offset := gravityOffsets[gravity]
+	free := bounds.Size().Sub(size)
+	origin := bounds.Min.Add(image.Pt(
+		int(math.Round(float64(free.X)*offset[0])),
+		int(math.Round(float64(free.Y)*offset[1])),
+	))
+
+	// Offsets move the watermark away from the edge it is attached to.
+	if offset[0] == 1 {
+		origin.X -= wm.OffsetX
+	} else {
+		origin.X += wm.OffsetX
+	}
+
+	if offset[1] == 1 {
+		origin.Y -= wm.OffsetY
+	} else {
+		origin.Y += wm.OffsetY
+	}
+
+	return []image.Point{origin}
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+func renderText(wm *Watermark) (image.Image, error) {
+	fontName := wm.Font
+	if fontName == "" {
+		fontName = "regular"
+	}
+
+	parsed, err := opentype.Parse(fonts[fontName])
+	if err != nil {
+		return nil, err
+	}
+
+	size := wm.Size
+	if size == 0 {
+		size = 24
+	}
+
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	var textColor color.Color = color.White
+	if wm.Color != "" {
+		if c, err := parseHexColor(wm.Color); err == nil {
+			textColor = c
+		}
+	}
+
+	metrics := face.Metrics()
+	width := font.MeasureString(face, wm.Text).Ceil()
+	height := (metrics.Ascent + metrics.Descent).Ceil()
+
+	overlay := image.NewRGBA(image.Rect(0, 0, max(1, width), max(1, height)))
+	drawer := &font.Drawer{
+		Dst:  overlay,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  fixed.Point26_6{X: 0, Y: metrics.Ascent},
+	}
+	drawer.DrawString(wm.Text)
+
+	return overlay, nil
+}
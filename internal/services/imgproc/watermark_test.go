@@ -0,0 +1,150 @@
+package imgproc_test
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/go-playground/validator/v10"
+)
+
+func TestWatermark(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	overlay := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	draw.Draw(overlay, overlay.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+
+	t.Run("text", func(t *testing.T) {
+		got, err := imgproc.Transform(img, &imgproc.Transformations{
+			Watermark: &imgproc.Watermark{Text: "imago", Size: 16},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		topLeft := got.(*image.RGBA).SubImage(image.Rect(0, 0, 100, 50))
+		if !samePixels(img.SubImage(image.Rect(0, 0, 100, 50)), topLeft) {
+			t.Error("expected the top left corner to be untouched")
+		}
+
+		bottomRight := got.(*image.RGBA).SubImage(image.Rect(100, 50, 200, 100))
+		if samePixels(img.SubImage(image.Rect(100, 50, 200, 100)), bottomRight) {
+			t.Error("expected the text to be drawn in the bottom right corner")
+		}
+	})
+
+	t.Run("image", func(t *testing.T) {
+		got, err := imgproc.Transform(img, &imgproc.Transformations{
+			Watermark: &imgproc.Watermark{
+				ImageID: 1,
+				Overlay: overlay,
+				Gravity: imgproc.GravityNorthWest,
+				OffsetX: 5,
+				OffsetY: 5,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		if !isColor(got, image.Pt(5, 5), 0xff, 0, 0) {
+			t.Errorf("expected overlay at the offset, got %v", got.At(5, 5))
+		}
+
+		if !isColor(got, image.Pt(4, 4), 0, 0, 0) {
+			t.Errorf("expected the image outside the offset, got %v", got.At(4, 4))
+		}
+	})
+
+	t.Run("scale", func(t *testing.T) {
+		got, err := imgproc.Transform(img, &imgproc.Transformations{
+			Watermark: &imgproc.Watermark{ImageID: 1, Overlay: overlay, Scale: 0.5},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		// The overlay is 100px wide, anchored at the bottom right corner.
+		if !isColor(got, image.Pt(100, 99), 0xff, 0, 0) {
+			t.Errorf("expected scaled overlay, got %v", got.At(100, 99))
+		}
+
+		if !isColor(got, image.Pt(99, 99), 0, 0, 0) {
+			t.Errorf("expected the image left of the overlay, got %v", got.At(99, 99))
+		}
+	})
+
+	t.Run("tile", func(t *testing.T) {
+		got, err := imgproc.Transform(img, &imgproc.Transformations{
+			Watermark: &imgproc.Watermark{ImageID: 1, Overlay: overlay, Tile: true, OffsetX: 10},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		for _, p := range []image.Point{{0, 0}, {30, 0}, {180, 90}} {
+			if !isColor(got, p, 0xff, 0, 0) {
+				t.Errorf("expected a tile at %v, got %v", p, got.At(p.X, p.Y))
+			}
+		}
+
+		if !isColor(got, image.Pt(25, 0), 0, 0, 0) {
+			t.Errorf("expected a gap between tiles, got %v", got.At(25, 0))
+		}
+	})
+
+	t.Run("spreads tiny tiles", func(t *testing.T) {
+		large := image.NewRGBA(image.Rect(0, 0, 640, 640))
+		draw.Draw(large, large.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+		pixel := image.NewRGBA(image.Rect(0, 0, 1, 1))
+		pixel.Set(0, 0, color.RGBA{255, 0, 0, 255})
+
+		got, err := imgproc.Transform(large, &imgproc.Transformations{
+			Watermark: &imgproc.Watermark{ImageID: 1, Overlay: pixel, Tile: true},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		// At most 64 tiles per row, 10px apart.
+		if !isColor(got, image.Pt(10, 0), 0xff, 0, 0) || !isColor(got, image.Pt(1, 0), 0, 0, 0) {
+			t.Errorf("expected tiles 10px apart, got %v and %v", got.At(10, 0), got.At(1, 0))
+		}
+	})
+
+	t.Run("opacity", func(t *testing.T) {
+		got, err := imgproc.Transform(img, &imgproc.Transformations{
+			Watermark: &imgproc.Watermark{ImageID: 1, Overlay: overlay, Opacity: 0.5},
+		})
+		if err != nil {
+			t.Fatalf("failed to transform image: %v", err)
+		}
+
+		r, g, b, _ := got.At(199, 99).RGBA()
+		if r>>8 < 120 || r>>8 > 135 || g != 0 || b != 0 {
+			t.Errorf("expected a half transparent overlay, got %v", got.At(199, 99))
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		validate := validator.New(validator.WithRequiredStructEnabled())
+		invalid := []imgproc.Watermark{
+			{},
+			{ImageID: 1, Text: "imago"},
+			{Text: "imago", Opacity: 2},
+			{Text: "imago", Font: "comic"},
+			{Text: "imago", Gravity: imgproc.GravityAuto},
+			{ImageID: 1, Scale: 2},
+		}
+
+		for _, wm := range invalid {
+			if err := validate.Struct(wm); err == nil {
+				t.Errorf("expected %+v to be invalid", wm)
+			}
+		}
+	})
+}
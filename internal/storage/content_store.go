@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// PublicPrefix is the prefix of the objects of public images. Blobs are
+// shared by every image with the same content, so public images get their
+// own copy and only this prefix is made readable on private buckets.
+const PublicPrefix = "public/"
+
+// RefCounter counts the references to each stored object.
+type RefCounter interface {
+	// Acquire adds a reference to the key and returns the reference count.
+	Acquire(ctx context.Context, key string, size int64) (int, error)
+	// Release removes a reference from the key and returns the remaining
+	// reference count. When it was the last one, unreferenced is called
+	// before the key is forgotten, and concurrent Acquires of the key wait
+	// for it. Unknown keys fail.
+	Release(ctx context.Context, key string, unreferenced func() error) (int, error)
+}
+
+// Downloader reads stored objects.
+type Downloader interface {
+	DownloadImage(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// ContentStore stores objects under keys derived from the SHA-256 of their
+// content, so identical bytes are stored once no matter how many images use
+// them. Objects are deleted when their last reference is released, they
+// are only written through the store so the references stay accurate.
+type ContentStore struct {
+	storage ImageStorage
+	refs    RefCounter
+}
+
+func NewContentStore(imageStorage ImageStorage, refs RefCounter) *ContentStore {
+	return &ContentStore{
+		imageStorage,
+		refs,
+	}
+}
+
+// ContentKey returns the storage key of the data, e.g.
+// "blobs/3a/3a7bd3e2360a3d...".
+func ContentKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return contentKey(hex.EncodeToString(sum[:]))
+}
+
+func contentKey(hash string) string {
+	return fmt.Sprintf("blobs/%s/%s", hash[:2], hash)
+}
+
+// PublicKey returns the key of the public copy of the content at key, e.g.
+// "public/blobs/3a/3a7bd3e2360a3d...".
+func PublicKey(key string) string {
+	return PublicPrefix + key
+}
+
+// ContentHash returns the hex SHA-256 of the content stored at the key.
+// Objects stored before content addressing have their key hashed instead,
+// their content never changes either.
+func ContentHash(key string) string {
+	hash := path.Base(key)
+	if len(hash) == 2*sha256.Size && strings.TrimPrefix(key, PublicPrefix) == contentKey(hash) {
+		return hash
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Put stores the data, or references the existing object with the same
+// content, and returns its key and url.
+func (c *ContentStore) Put(ctx context.Context, data []byte) (string, string, error) {
+	return c.put(ctx, ContentKey(data), int64(len(data)), bytes.NewReader(data))
+}
+
+// PutSpool is like Put for spooled uploads, the content is streamed from
+// disk.
+func (c *ContentStore) PutSpool(ctx context.Context, spool *Spool) (string, string, error) {
+	return c.put(ctx, spool.Key(), spool.Size(), spool.Reader())
+}
+
+// PutPublicSpool is like PutSpool but stores the content under
+// PublicPrefix, apart from the blobs of private images.
+func (c *ContentStore) PutPublicSpool(ctx context.Context, spool *Spool) (string, string, error) {
+	return c.put(ctx, PublicKey(spool.Key()), spool.Size(), spool.Reader())
+}
+
+func (c *ContentStore) put(
+	ctx context.Context,
+	key string,
+	size int64,
+	content io.Reader,
+) (string, string, error) {
+	refs, err := c.refs.Acquire(ctx, key, size)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to reference object: %w", err)
+	}
+
+	if refs > 1 {
+		// A concurrent first upload may still be in progress, in which case
+		// the object is uploaded again with the same content.
+		if url, err := c.storage.GetImage(ctx, key); err == nil {
+			return key, url, nil
+		}
+	}
+
+	url, err := c.storage.Upload(ctx, content, key)
+	if err != nil {
+		_ = c.Release(ctx, key)
+		return "", "", err
+	}
+
+	return key, url, nil
+}
+
+// Release removes a reference to the object and deletes it once nothing
+// references it anymore. The object is deleted while the reference is
+// locked, so a concurrent Put of the same content uploads it again after.
+func (c *ContentStore) Release(ctx context.Context, key string) error {
+	_, err := c.refs.Release(ctx, key, func() error {
+		return c.storage.Delete(ctx, key)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release object: %w", err)
+	}
+
+	return nil
+}
+
+func (c *ContentStore) DownloadImage(ctx context.Context, key string) (io.ReadCloser, error) {
+	return c.storage.DownloadImage(ctx, key)
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Storage drivers selectable by configuration.
+const (
+	DriverS3     = "s3"
+	DriverFS     = "fs"
+	DriverMemory = "memory"
+)
+
+// Factory hands out the storage of the configured driver, so handlers and
+// consumers don't depend on a specific backend.
+type Factory struct {
+	imageStorage ImageStorage
+	presigner    Presigner
+}
+
+// NewS3Factory presigns urls with presignClient, which may be configured
+// with the endpoint clients reach the storage at, while client is used by
+// the API itself.
+func NewS3Factory(client, presignClient *s3.Client, bucket, publicBaseURL string) *Factory {
+	return &Factory{
+		NewS3ImageStorage(client, bucket, publicBaseURL),
+		NewS3Presigner(presignClient, bucket),
+	}
+}
+
+// NewFSFactory stores objects under root. Their urls are relative to
+// baseURL, where they are expected to be served from.
+func NewFSFactory(root, baseURL string) *Factory {
+	return &Factory{
+		NewFSImageStorage(root, baseURL),
+		nil,
+	}
+}
+
+// NewMemoryFactory keeps objects in memory, they are lost on restart.
+func NewMemoryFactory(baseURL string) *Factory {
+	return &Factory{
+		NewMemoryImageStorage(baseURL),
+		nil,
+	}
+}
+
+func (f *Factory) ImageStorage() ImageStorage {
+	return f.imageStorage
+}
+
+// Presigner returns nil for drivers clients can't reach directly, which
+// support neither direct uploads nor presigned urls.
+func (f *Factory) Presigner() Presigner {
+	return f.presigner
+}
@@ -3,49 +3,93 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 type ImageStorage interface {
-	Upload(ctx context.Context, imgData []byte, path string) (string, error)
+	// Upload streams the content to the path. Large contents are uploaded
+	// in parts where supported.
+	Upload(ctx context.Context, content io.Reader, path string) (string, error)
 	GetImage(ctx context.Context, path string) (string, error)
+	// DownloadImage opens the object for reading. The reader implements
+	// io.Seeker where supported, so ranges are read without downloading
+	// the whole object.
 	DownloadImage(ctx context.Context, url string) (io.ReadCloser, error)
 	Delete(ctx context.Context, path string) error
 }
 
 type s3ImageStorage struct {
-	client *s3.Client
-	bucket string
+	client   *s3.Client
+	uploader *manager.Uploader
+	bucket   string
+	baseURL  string
 }
 
-func NewS3ImageStorage(client *s3.Client, bucket string) ImageStorage {
+// NewS3ImageStorage returns urls under publicBaseURL, or under the bucket
+// url of the client endpoint when empty.
+func NewS3ImageStorage(client *s3.Client, bucket, publicBaseURL string) ImageStorage {
 	return &s3ImageStorage{
 		client,
+		manager.NewUploader(client),
 		bucket,
+		s3BaseURL(client.Options(), bucket, publicBaseURL),
 	}
 }
 
+// s3BaseURL returns the url the objects of the bucket are under. The bucket
+// is in the host of the endpoint, or in its path with path-style addressing.
+func s3BaseURL(opts s3.Options, bucket, publicBaseURL string) string {
+	if publicBaseURL != "" {
+		return publicBaseURL
+	}
+
+	endpoint := "https://s3.amazonaws.com"
+	if opts.Region != "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", opts.Region)
+	}
+	if opts.BaseEndpoint != nil {
+		endpoint = *opts.BaseEndpoint
+	}
+
+	base, err := url.Parse(endpoint)
+	if err != nil || opts.UsePathStyle {
+		return objectURL(endpoint, bucket)
+	}
+
+	base.Host = bucket + "." + base.Host
+	return base.String()
+}
+
+// Upload uses a multipart upload for contents larger than a part, 5MB.
+// Contents implementing io.ReaderAt and io.Seeker are read in place,
+// others are buffered one part at a time.
 func (s *s3ImageStorage) Upload(
 	ctx context.Context,
-	imgData []byte,
+	content io.Reader,
 	path string,
 ) (string, error) {
-	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
 		Key:    aws.String(path),
 		Bucket: aws.String(s.bucket),
-		Body:   bytes.NewReader(imgData),
+		Body:   content,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to upload image: %w", err)
 	}
 
-	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", s.bucket, path), nil
+	return objectURL(s.baseURL, path), nil
 }
 
 func (s *s3ImageStorage) GetImage(ctx context.Context, path string) (string, error) {
@@ -57,11 +101,13 @@ func (s *s3ImageStorage) GetImage(ctx context.Context, path string) (string, err
 		return "", fmt.Errorf("failed to get image or does not exist: %w", err)
 	}
 
-	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", s.bucket, path), nil
+	return objectURL(s.baseURL, path), nil
 }
 
+// DownloadImage only fetches the size of the object, its content is
+// requested on the first read, from the offset of the reader.
 func (s *s3ImageStorage) DownloadImage(ctx context.Context, url string) (io.ReadCloser, error) {
-	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+	head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(url),
 	})
@@ -69,7 +115,86 @@ func (s *s3ImageStorage) DownloadImage(ctx context.Context, url string) (io.Read
 		return nil, fmt.Errorf("failed to download image: %w", err)
 	}
 
-	return resp.Body, nil
+	return &s3Object{
+		ctx:    ctx,
+		client: s.client,
+		bucket: s.bucket,
+		key:    url,
+		size:   aws.ToInt64(head.ContentLength),
+	}, nil
+}
+
+// s3Object reads an object from its offset. Seeking drops the response
+// being read and the next read requests the range from the new offset.
+type s3Object struct {
+	ctx    context.Context
+	client *s3.Client
+	bucket string
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(o.bucket),
+			Key:    aws.String(o.key),
+		}
+		if o.offset > 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", o.offset))
+		}
+
+		resp, err := o.client.GetObject(o.ctx, input)
+		if err != nil {
+			return 0, fmt.Errorf("failed to download image: %w", err)
+		}
+		o.body = resp.Body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if offset != o.offset {
+		_ = o.Close()
+		o.offset = offset
+	}
+
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+
+	err := o.body.Close()
+	o.body = nil
+
+	return err
 }
 
 func (s *s3ImageStorage) Delete(ctx context.Context, path string) error {
@@ -81,42 +206,183 @@ func (s *s3ImageStorage) Delete(ctx context.Context, path string) error {
 	return err
 }
 
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// fsImageStorage stores objects as files under root. Keys are slash
+// separated paths that must stay inside root.
 type fsImageStorage struct {
-	root string
+	root    string
+	baseURL string
 }
 
-func NewFSImageStorage(root string) ImageStorage {
+// NewFSImageStorage returns urls relative to baseURL, or file paths when
+// baseURL is empty.
+func NewFSImageStorage(root, baseURL string) ImageStorage {
 	return &fsImageStorage{
 		root,
+		baseURL,
+	}
+}
+
+// resolve returns the file of the key, rejecting absolute keys and keys
+// escaping the root.
+func (f *fsImageStorage) resolve(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
 	}
+
+	return filepath.Join(f.root, filepath.FromSlash(key)), nil
+}
+
+func (f *fsImageStorage) url(key, file string) string {
+	if f.baseURL == "" {
+		return file
+	}
+
+	return objectURL(f.baseURL, key)
 }
 
 func (f *fsImageStorage) Upload(
 	_ context.Context,
-	imgData []byte,
+	content io.Reader,
 	path string,
 ) (string, error) {
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(filepath.Join(f.root, dir), 0755); err != nil {
+	name, err := f.resolve(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
 		return "", fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	if err := os.WriteFile(filepath.Join(f.root, path), imgData, 0600); err != nil {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
 		return "", fmt.Errorf("failed to write image: %w", err)
 	}
+	defer file.Close()
 
-	return filepath.Join(f.root, path), nil
+	if _, err := io.Copy(file, content); err != nil {
+		return "", fmt.Errorf("failed to write image: %w", err)
+	}
+
+	return f.url(path, name), nil
 }
 
 func (f *fsImageStorage) GetImage(_ context.Context, path string) (string, error) {
-	_, err := os.Open(path)
-	return filepath.Join(f.root, path), err
+	name, err := f.resolve(path)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = os.Stat(name)
+	return f.url(path, name), err
 }
 
 func (f *fsImageStorage) DownloadImage(_ context.Context, url string) (io.ReadCloser, error) {
-	return os.Open(filepath.Join(f.root, url))
+	name, err := f.resolve(url)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := file.Stat(); err == nil && info.IsDir() {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s is a directory", fs.ErrNotExist, url)
+	}
+
+	return file, nil
 }
 
 func (f *fsImageStorage) Delete(_ context.Context, path string) error {
-	return os.Remove(filepath.Join(f.root, path))
+	name, err := f.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	// Like S3, deleting a missing object succeeds.
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// memoryImageStorage keeps objects in memory, for development and tests.
+type memoryImageStorage struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+	baseURL string
+}
+
+func NewMemoryImageStorage(baseURL string) ImageStorage {
+	return &memoryImageStorage{
+		objects: map[string][]byte{},
+		baseURL: baseURL,
+	}
+}
+
+func (m *memoryImageStorage) Upload(
+	_ context.Context,
+	content io.Reader,
+	path string,
+) (string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload image: %w", err)
+	}
+
+	m.mu.Lock()
+	m.objects[path] = data
+	m.mu.Unlock()
+
+	return objectURL(m.baseURL, path), nil
+}
+
+func (m *memoryImageStorage) GetImage(_ context.Context, path string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.objects[path]; !ok {
+		return "", fmt.Errorf("failed to get image or does not exist: %w", fs.ErrNotExist)
+	}
+
+	return objectURL(m.baseURL, path), nil
+}
+
+func (m *memoryImageStorage) DownloadImage(_ context.Context, url string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.objects[url]
+	if !ok {
+		return nil, fmt.Errorf("failed to download image: %w", fs.ErrNotExist)
+	}
+
+	return memoryObject{bytes.NewReader(data)}, nil
+}
+
+func (m *memoryImageStorage) Delete(_ context.Context, path string) error {
+	m.mu.Lock()
+	delete(m.objects, path)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// memoryObject is a seekable reader of an object, with nothing to close.
+type memoryObject struct {
+	*bytes.Reader
+}
+
+func (memoryObject) Close() error {
+	return nil
+}
+
+func objectURL(baseURL, key string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + key
 }
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestS3BaseURL(t *testing.T) {
+	testCases := []struct {
+		name          string
+		opts          s3.Options
+		publicBaseURL string
+		want          string
+	}{
+		{
+			name: "virtual-host",
+			opts: s3.Options{Region: "sa-east-1"},
+			want: "https://imago.s3.sa-east-1.amazonaws.com",
+		},
+		{
+			name: "path-style",
+			opts: s3.Options{Region: "sa-east-1", UsePathStyle: true},
+			want: "https://s3.sa-east-1.amazonaws.com/imago",
+		},
+		{
+			name: "custom endpoint",
+			opts: s3.Options{BaseEndpoint: aws.String("https://storage.example.com")},
+			want: "https://imago.storage.example.com",
+		},
+		{
+			name: "custom endpoint with path-style",
+			opts: s3.Options{
+				BaseEndpoint: aws.String("http://minio:9000"),
+				UsePathStyle: true,
+			},
+			want: "http://minio:9000/imago",
+		},
+		{
+			name: "public base url",
+			opts: s3.Options{
+				BaseEndpoint: aws.String("http://minio:9000"),
+				UsePathStyle: true,
+			},
+			publicBaseURL: "https://cdn.example.com/images",
+			want:          "https://cdn.example.com/images",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := s3BaseURL(tc.opts, "imago", tc.publicBaseURL)
+			if got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Presigner signs requests that clients send straight to the storage,
+// without going through the API.
+type Presigner interface {
+	// PresignUpload returns a PUT url accepting exactly size bytes at the
+	// path until it expires.
+	PresignUpload(ctx context.Context, path string, size int64, expires time.Duration) (string, error)
+	// PresignDownload returns a GET url reading the object at the path
+	// until it expires, for private buckets.
+	PresignDownload(ctx context.Context, path string, expires time.Duration) (string, error)
+}
+
+type s3Presigner struct {
+	client *s3.PresignClient
+	bucket string
+}
+
+func NewS3Presigner(client *s3.Client, bucket string) Presigner {
+	return &s3Presigner{
+		s3.NewPresignClient(client),
+		bucket,
+	}
+}
+
+func (p *s3Presigner) PresignUpload(
+	ctx context.Context,
+	path string,
+	size int64,
+	expires time.Duration,
+) (string, error) {
+	req, err := p.client.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(p.bucket),
+		Key:           aws.String(path),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign upload: %w", err)
+	}
+
+	return req.URL, nil
+}
+
+func (p *s3Presigner) PresignDownload(
+	ctx context.Context,
+	path string,
+	expires time.Duration,
+) (string, error) {
+	req, err := p.client.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(path),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download: %w", err)
+	}
+
+	return req.URL, nil
+}
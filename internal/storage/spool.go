@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Spool is a temporary copy of an upload on disk, so uploads don't have to
+// be kept in memory. The content is hashed while written, which gives its
+// content key before it is stored.
+type Spool struct {
+	file *os.File
+	size int64
+	hash string
+}
+
+// NewSpool copies r to a temporary file. Errors from r, such as the one of
+// an http.MaxBytesReader, are wrapped.
+func NewSpool(r io.Reader) (*Spool, error) {
+	file, err := os.CreateTemp("", "imago-upload-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, h), r)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to spool upload: %w", err)
+	}
+
+	return &Spool{
+		file: file,
+		size: size,
+		hash: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// Key returns the content key of the spooled data, see ContentKey.
+func (s *Spool) Key() string {
+	return contentKey(s.hash)
+}
+
+func (s *Spool) Size() int64 {
+	return s.size
+}
+
+// Name returns the path of the spool file, for tools that read files.
+func (s *Spool) Name() string {
+	return s.file.Name()
+}
+
+// Reader returns a reader of the whole content. Readers are independent of
+// each other.
+func (s *Spool) Reader() *io.SectionReader {
+	return io.NewSectionReader(s.file, 0, s.size)
+}
+
+// Head returns up to the first n bytes of the content.
+func (s *Spool) Head(n int) ([]byte, error) {
+	head := make([]byte, min(int64(n), s.size))
+	if _, err := s.file.ReadAt(head, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read spool: %w", err)
+	}
+
+	return head, nil
+}
+
+// Close removes the spool file.
+func (s *Spool) Close() error {
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
@@ -10,12 +10,15 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/edulustosa/imago/config"
 	"github.com/edulustosa/imago/internal/api/router"
 	"github.com/edulustosa/imago/internal/queue"
+	"github.com/edulustosa/imago/internal/services/imgproc"
+	"github.com/edulustosa/imago/internal/storage"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
@@ -64,9 +67,15 @@ func run(ctx context.Context) error {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	s3Client, err := loadS3Client(ctx, env)
+	storageFactory, err := newStorage(ctx, env)
 	if err != nil {
-		return fmt.Errorf("failed to load S3 client: %w", err)
+		return err
+	}
+
+	// Local drivers serve every file unauthenticated under /files, they
+	// can't keep images private.
+	if env.PrivateBucket && storageFactory.Presigner() == nil {
+		return fmt.Errorf("PRIVATE_BUCKET is not supported by the %q storage driver", env.StorageDriver)
 	}
 
 	redisClient, err := connectToRedis(ctx, env.RedisURL)
@@ -82,12 +91,14 @@ func run(ctx context.Context) error {
 		AllowAutoTopicCreation: true,
 	}
 
+	limits := tierLimits(env)
 	r := router.New(router.Server{
 		Database:    pool,
 		Env:         env,
-		S3Client:    s3Client,
+		Storage:     storageFactory,
 		RedisClient: redisClient,
 		KafkaWriter: kafkaWriter,
+		Limits:      limits,
 	})
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%s", env.Addr),
@@ -110,8 +121,8 @@ func run(ctx context.Context) error {
 		kafkaReader,
 		redisClient,
 		pool,
-		s3Client,
-		env.BucketName,
+		storageFactory,
+		limits,
 	)
 	consumer.Start(ctx)
 	defer consumer.Stop()
@@ -164,6 +175,31 @@ func runMigrations(ctx context.Context, pool *pgxpool.Pool) error {
 	return nil
 }
 
+func newStorage(ctx context.Context, env *config.Env) (*storage.Factory, error) {
+	switch env.StorageDriver {
+	case storage.DriverS3:
+		s3Client, err := loadS3Client(ctx, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load S3 client: %w", err)
+		}
+
+		presignClient := s3Client
+		if env.S3PresignEndpointURL != "" {
+			presignClient = s3.New(s3Client.Options(), func(o *s3.Options) {
+				o.BaseEndpoint = aws.String(env.S3PresignEndpointURL)
+			})
+		}
+
+		return storage.NewS3Factory(s3Client, presignClient, env.BucketName, env.S3PublicBaseURL), nil
+	case storage.DriverFS:
+		return storage.NewFSFactory(env.StorageRoot, env.FilesBaseURL), nil
+	case storage.DriverMemory:
+		return storage.NewMemoryFactory(env.FilesBaseURL), nil
+	}
+
+	return nil, fmt.Errorf("unknown storage driver %q", env.StorageDriver)
+}
+
 func loadS3Client(ctx context.Context, env *config.Env) (*s3.Client, error) {
 	cfg, err := awsConfig.LoadDefaultConfig(
 		ctx,
@@ -176,7 +212,31 @@ func loadS3Client(ctx context.Context, env *config.Env) (*s3.Client, error) {
 		return nil, err
 	}
 
-	return s3.NewFromConfig(cfg), nil
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if env.AWSEndpointURL != "" {
+			o.BaseEndpoint = aws.String(env.AWSEndpointURL)
+		}
+		o.UsePathStyle = env.AWSUsePathStyle
+	}), nil
+}
+
+func tierLimits(env *config.Env) imgproc.TierLimits {
+	return imgproc.TierLimits{
+		imgproc.TierFree: {
+			MaxPixels:      env.FreeMaxPixels,
+			MaxWidth:       env.FreeMaxWidth,
+			MaxHeight:      env.FreeMaxHeight,
+			MaxFrames:      env.FreeMaxFrames,
+			MaxTotalPixels: env.FreeMaxTotalPixels,
+		},
+		imgproc.TierPro: {
+			MaxPixels:      env.ProMaxPixels,
+			MaxWidth:       env.ProMaxWidth,
+			MaxHeight:      env.ProMaxHeight,
+			MaxFrames:      env.ProMaxFrames,
+			MaxTotalPixels: env.ProMaxTotalPixels,
+		},
+	}
 }
 
 func connectToRedis(ctx context.Context, url string) (*redis.Client, error) {